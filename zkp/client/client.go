@@ -0,0 +1,550 @@
+// Package client is a Go SDK for the zkp Auth service. It runs the SRP
+// exchange so the password never leaves the process, checks that the server
+// knows the verifier and keeps the session tokens.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/1Password/srp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// defaults for a new Client
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 200 * time.Millisecond
+	DefaultTimeout = 10 * time.Second
+)
+
+// maxRetryDelay is the longest we wait before trying again, a locked
+// account is better reported than waited out
+const maxRetryDelay = 30 * time.Second
+
+// Client talks to the Auth service on behalf of one user at a time
+type Client struct {
+	Auth pb.AuthClient
+
+	conn        *grpc.ClientConn
+	dialOptions []grpc.DialOption
+	group       *srp.Group
+	groupSet    bool
+	kdf         *pb.KDFParameters
+	kdfSet      bool
+	retries     int
+	backoff     time.Duration
+	timeout     time.Duration
+	tokens      TokenStore
+	totpCode    func(ctx context.Context) (string, error)
+	tenant      string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithDialOptions will pass extra options to grpc.Dial, they are applied
+// after the defaults so they can replace the transport credentials
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
+// WithInsecure will dial without TLS, only use it for local development
+func WithInsecure() Option {
+	return WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// WithTLS will dial with the given TLS config
+func WithTLS(config *tls.Config) Option {
+	return WithDialOptions(grpc.WithTransportCredentials(credentials.NewTLS(config)))
+}
+
+// WithRetries sets how often a call that failed because the server was
+// unavailable or busy is tried again, and the first back-off between tries
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithTimeout sets the deadline of each try of a call, the deadline of the
+// caller's context still applies to the call as a whole
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithGroup sets the RFC 5054 group new verifiers are made for, one of the
+// srp.RFC5054Group constants. By default we use the one the server suggests.
+func WithGroup(group int) Option {
+	return func(c *Client) {
+		if g, ok := srp.KnownGroups[group]; ok {
+			c.group = g
+			c.groupSet = true
+		}
+	}
+}
+
+// WithTokenStore sets where the session is kept, the default is memory
+func WithTokenStore(ts TokenStore) Option {
+	return func(c *Client) {
+		c.tokens = ts
+	}
+}
+
+// WithTOTPPrompt sets how Login asks for a TOTP or recovery code when the
+// account has a second factor. Without it Login returns a
+// *SecondFactorRequired error to be finished with VerifyTOTP.
+func WithTOTPPrompt(code func(ctx context.Context) (string, error)) Option {
+	return func(c *Client) {
+		c.totpCode = code
+	}
+}
+
+// WithTenant sets the tenant the user belongs to, the server's default
+// tenant is used without it
+func WithTenant(id string) Option {
+	return func(c *Client) {
+		c.tenant = id
+	}
+}
+
+// New will create a new Client on an existing connection
+func New(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	c := &Client{
+		Auth:    pb.NewAuthClient(conn),
+		group:   srp.KnownGroups[srp.RFC5054Group3072],
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+		timeout: DefaultTimeout,
+		tokens:  &MemoryStore{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Dial will connect to the Auth service at target, over TLS unless the
+// options say otherwise
+func Dial(target string, opts ...Option) (*Client, error) {
+	c := New(nil, opts...)
+
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})),
+	}, c.dialOptions...)
+	conn, err := grpc.Dial(target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.Auth = pb.NewAuthClient(conn)
+
+	return c, nil
+}
+
+// Close will close the connection if the Client made it
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+// Register will enroll a new user, the server only ever sees a salt and verifier
+func (c *Client) Register(ctx context.Context, username, password string) error {
+	group, k, err := c.parameters(ctx)
+	if err != nil {
+		return err
+	}
+	e, err := enroll(group, k, username, password)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, func(ctx context.Context) error {
+		_, err := c.Auth.Register(ctx, &pb.RegisterRequest{
+			Username: username,
+			Salt:     e.salt,
+			GroupId:  e.groupID,
+			Verifier: e.verifier,
+			Kdf:      e.kdf,
+		})
+		return err
+	})
+}
+
+// parameters returns the group and KDF to make a new verifier with, as the
+// server suggests unless WithGroup said otherwise
+func (c *Client) parameters(ctx context.Context) (*srp.Group, *pb.KDFParameters, error) {
+	if c.kdfSet {
+		return c.group, c.kdf, nil
+	}
+
+	var resp *pb.GetParametersResponse
+	err := c.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Auth.GetParameters(ctx, &pb.GetParametersRequest{})
+		return err
+	})
+	if status.Code(err) == codes.Unimplemented {
+		// an older server, which only knew our default group and rfc5054
+		return c.group, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !c.groupSet {
+		g, err := groupByLabel(resp.DefaultGroupId)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.group, c.groupSet = g, true
+	}
+	c.kdf, c.kdfSet = resp.Kdf, true
+
+	return c.group, c.kdf, nil
+}
+
+// Login will prove knowledge of the password and store the new session. It
+// returns ErrPasswordResetRequired when the password has to be changed
+// before there is a session.
+func (c *Client) Login(ctx context.Context, username, password string) (*Session, error) {
+	var session *Session
+	var upgrade *pb.KDFParameters
+	err := c.do(ctx, func(ctx context.Context) error {
+		// handshakes are single use, so every try starts over
+		var err error
+		session, upgrade, err = c.login(ctx, username, password)
+		return err
+	})
+	var pending *SecondFactorRequired
+	if errors.As(err, &pending) && c.totpCode != nil {
+		code, cerr := c.totpCode(ctx)
+		if cerr != nil {
+			return nil, cerr
+		}
+		session, err = c.verifyTOTP(ctx, pending, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the password is about to change anyway
+	if session.ResetRequired {
+		if err := c.tokens.Save(session); err != nil {
+			return nil, err
+		}
+		return nil, ErrPasswordResetRequired
+	}
+
+	// the server wants a stronger KDF, we still have the password so we can
+	// enroll it again without bothering the user. If that fails we are still
+	// logged in and will be asked again next time.
+	if upgrade != nil {
+		group, _, err := c.parameters(ctx)
+		if err == nil {
+			if s, err := c.changeVerifier(ctx, session, group, upgrade, password); err == nil {
+				session = s
+			}
+		}
+	}
+
+	if err := c.tokens.Save(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// login runs one SRP exchange, it also returns the KDF the server wants us
+// to enroll with again, if any. When the account has a second factor the
+// error is a *SecondFactorRequired.
+func (c *Client) login(ctx context.Context, username, password string) (*Session, *pb.KDFParameters, error) {
+	e, loginResp, err := c.start(ctx, username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := e.Prove(username, password, loginResp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validateResp, err := c.Auth.Validate(ctx, &pb.ValidateRequest{
+		HandshakeId: loginResp.HandshakeId,
+		Proof:       proof,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := e.Verify(validateResp.ServerProof)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session := &Session{
+		Username:     username,
+		Token:        validateResp.Token,
+		ExpiresAt:    time.Unix(validateResp.ExpiresAt, 0),
+		RefreshToken: validateResp.RefreshToken,
+		Key:          key,
+
+		ResetRequired: validateResp.PasswordResetRequired,
+	}
+	if validateResp.SecondFactorRequired {
+		return nil, validateResp.UpgradeKdf, &SecondFactorRequired{
+			Challenge: validateResp.Challenge,
+			ExpiresAt: time.Unix(validateResp.ChallengeExpiresAt, 0),
+			session:   session,
+		}
+	}
+
+	return session, validateResp.UpgradeKdf, nil
+}
+
+// start will send A and return the server's reply. A has to be made in the
+// group the account was enrolled with, which the server only tells us in
+// its reply, so we start over once if our guess was wrong.
+func (c *Client) start(ctx context.Context, username string) (*exchange, *pb.LoginResponse, error) {
+	group := c.group
+	for i := 0; i < 2; i++ {
+		e, err := newExchange(group)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := c.Auth.Login(ctx, &pb.LoginRequest{
+			Username:  username,
+			PublicKey: e.PublicKey(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.GroupId == "" || resp.GroupId == group.Label {
+			return e, resp, nil
+		}
+
+		group, err = groupByLabel(resp.GroupId)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return nil, nil, errors.New("server keeps changing srp group")
+}
+
+// Session returns the stored session, refreshing it when the token has expired
+func (c *Client) Session(ctx context.Context) (*Session, error) {
+	session, err := c.tokens.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !session.Expired() {
+		return session, nil
+	}
+
+	return c.Refresh(ctx)
+}
+
+// Refresh will trade the refresh token for a new session token
+func (c *Client) Refresh(ctx context.Context) (*Session, error) {
+	session, err := c.tokens.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *pb.RefreshTokenResponse
+	err = c.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Auth.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session.Token = resp.Token
+	session.ExpiresAt = time.Unix(resp.ExpiresAt, 0)
+	session.RefreshToken = resp.RefreshToken
+	if err := c.tokens.Save(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// AuthContext returns ctx carrying the session token, for calls to c.Auth
+// that need one
+func (c *Client) AuthContext(ctx context.Context) (context.Context, error) {
+	session, err := c.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+session.Token), nil
+}
+
+// ChangePassword will enroll the logged in user with a new password, the
+// server ends every other session and this one carries on. It is also how
+// a session left by ErrPasswordResetRequired becomes a full one.
+func (c *Client) ChangePassword(ctx context.Context, password string) (*Session, error) {
+	session, err := c.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group, k, err := c.parameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err = c.changeVerifier(ctx, session, group, k, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.tokens.Save(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// changeVerifier will enroll password for the session's user and return the
+// session the server replaces it with
+func (c *Client) changeVerifier(ctx context.Context, session *Session, group *srp.Group, k *pb.KDFParameters, password string) (*Session, error) {
+	e, err := enroll(group, k, session.Username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *pb.ChangeVerifierResponse
+	err = c.do(ctx, func(ctx context.Context) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+session.Token)
+		var err error
+		resp, err = c.Auth.ChangeVerifier(ctx, &pb.ChangeVerifierRequest{
+			Salt:     e.salt,
+			GroupId:  e.groupID,
+			Verifier: e.verifier,
+			Kdf:      e.kdf,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := *session
+	s.Token = resp.Token
+	s.ExpiresAt = time.Unix(resp.ExpiresAt, 0)
+	s.RefreshToken = resp.RefreshToken
+	s.ResetRequired = false
+
+	return &s, nil
+}
+
+// Logout will end the session on the server and forget it
+func (c *Client) Logout(ctx context.Context) error {
+	ctx, err := c.AuthContext(ctx)
+	if errors.Is(err, ErrNoSession) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// a single try, a retried logout of an already revoked session would fail
+	callCtx, cancel := c.callContext(ctx)
+	defer cancel()
+	if _, err := c.Auth.Logout(callCtx, &pb.LogoutRequest{}); err != nil {
+		return err
+	}
+
+	return c.tokens.Clear()
+}
+
+// do will run fn, trying again with exponential back-off while the server is
+// unavailable or asks us to slow down
+func (c *Client) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := c.callContext(ctx)
+		err := fn(callCtx)
+		cancel()
+		if err == nil || attempt >= c.retries {
+			return err
+		}
+
+		delay, ok := retryDelay(err, backoff)
+		if !ok {
+			return err
+		}
+		backoff *= 2
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// callContext returns the context for a single try
+func (c *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = c.tenantContext(ctx)
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// tenantContext returns ctx naming our tenant, if we have one
+func (c *Client) tenantContext(ctx context.Context) context.Context {
+	if c.tenant == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "x-tenant-id", c.tenant)
+}
+
+// retryDelay tells whether err is worth another try and how long to wait,
+// the server's RetryInfo wins over our own back-off
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.Unavailable:
+		return backoff, true
+	case codes.ResourceExhausted:
+		for _, d := range st.Details() {
+			if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay != nil {
+				delay := ri.RetryDelay.AsDuration()
+				return delay, delay <= maxRetryDelay
+			}
+		}
+		return backoff, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"math/big"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// KDF algorithms the server may ask for
+const (
+	KDFRFC5054  = kdf.RFC5054
+	KDFArgon2id = kdf.Argon2id
+	KDFPBKDF2   = kdf.PBKDF2
+)
+
+// deriveX will turn the password into the SRP private key x with the given
+// KDF, none means rfc5054
+func deriveX(k *pb.KDFParameters, salt []byte, username, password string) (*big.Int, error) {
+	var p kdf.Params
+	if k != nil {
+		p = kdf.Params{
+			Algorithm:   k.Algorithm,
+			Iterations:  k.Iterations,
+			Memory:      k.Memory,
+			Parallelism: k.Parallelism,
+		}
+	}
+
+	return p.Derive(salt, username, password)
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+
+	"github.com/imthaghost/goland/zkp/internal/channel"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+var (
+	// ErrNoSessionKey is returned by SecureExchange when the session key K
+	// is not known, as it is never saved sessions loaded from disk lack it
+	ErrNoSessionKey = errors.New("session key not available, log in again")
+	// ErrReplay is returned for a message from the server that is out of order or seen before
+	ErrReplay = channel.ErrReplay
+	// ErrBadMessage is returned for a message from the server that does not open
+	ErrBadMessage = channel.ErrBadMessage
+)
+
+// SecureConn is a SecureExchange stream. Messages are sealed with keys
+// derived from the SRP session key K, which only we and the server know,
+// so nothing between us can read or change them, TLS terminators included.
+// Send and Recv may be called from different goroutines, but neither from two.
+type SecureConn struct {
+	stream pb.Auth_SecureExchangeClient
+	seal   *channel.Cipher
+	open   *channel.Cipher
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// SecureExchange will open a stream for the logged in session. What the
+// messages mean is up to the server's handler, it echoes them by default.
+func (c *Client) SecureExchange(ctx context.Context) (*SecureConn, error) {
+	session, err := c.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.Key) == 0 {
+		return nil, ErrNoSessionKey
+	}
+	ctx, err = c.AuthContext(c.tenantContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sc, err := c.openSecure(ctx, session)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sc.cancel = cancel
+
+	return sc, nil
+}
+
+// openSecure will trade randoms with the server and derive the keys of the stream
+func (c *Client) openSecure(ctx context.Context, session *Session) (*SecureConn, error) {
+	stream, err := c.Auth.SecureExchange(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, channel.RandomLength)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&pb.SecureFrame{Random: random}); err != nil {
+		return nil, err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if len(first.Random) != channel.RandomLength {
+		return nil, errors.New("server sent a malformed random")
+	}
+
+	// we seal with the client to server key and open with the other one
+	seal, open, err := channel.Derive(session.Key, random, first.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecureConn{
+		stream: stream,
+		seal:   seal,
+		open:   open,
+	}, nil
+}
+
+// Send will seal a message and send it to the server
+func (sc *SecureConn) Send(msg []byte) error {
+	n, ciphertext, err := sc.seal.Seal(msg)
+	if err != nil {
+		return err
+	}
+
+	return sc.stream.Send(&pb.SecureFrame{
+		Counter:    n,
+		Ciphertext: ciphertext,
+	})
+}
+
+// Recv will return the next message from the server, or io.EOF once the
+// server has ended the stream
+func (sc *SecureConn) Recv() ([]byte, error) {
+	f, err := sc.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	return sc.open.Open(f.Counter, f.Ciphertext)
+}
+
+// CloseSend will tell the server we are done sending, Recv still works
+// until the server ends the stream
+func (sc *SecureConn) CloseSend() error {
+	return sc.stream.CloseSend()
+}
+
+// Close will end the stream in both directions
+func (sc *SecureConn) Close() error {
+	sc.once.Do(sc.cancel)
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/internal/channel"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc"
+)
+
+// fakeStream records what the client sends and hands it frames queued by
+// the test, as if from the server
+type fakeStream struct {
+	grpc.ClientStream
+	sent []*pb.SecureFrame
+	recv []*pb.SecureFrame
+}
+
+func (s *fakeStream) Send(f *pb.SecureFrame) error {
+	s.sent = append(s.sent, f)
+	return nil
+}
+
+func (s *fakeStream) Recv() (*pb.SecureFrame, error) {
+	if len(s.recv) == 0 {
+		return nil, io.EOF
+	}
+	f := s.recv[0]
+	s.recv = s.recv[1:]
+	return f, nil
+}
+
+// fakeAuth opens SecureExchange streams on a fakeStream
+type fakeAuth struct {
+	pb.AuthClient
+	stream *fakeStream
+}
+
+func (a *fakeAuth) SecureExchange(ctx context.Context, opts ...grpc.CallOption) (pb.Auth_SecureExchangeClient, error) {
+	return a.stream, nil
+}
+
+// openPair opens a client stream and returns it with the ciphers the server
+// derives for it
+func openPair(t *testing.T) (sc *SecureConn, stream *fakeStream, fromClient, fromServer *channel.Cipher) {
+	t.Helper()
+
+	key := make([]byte, 32)
+	serverRandom := make([]byte, channel.RandomLength)
+	for _, b := range [][]byte{key, serverRandom} {
+		if _, err := rand.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stream = &fakeStream{recv: []*pb.SecureFrame{{Random: serverRandom}}}
+	c := &Client{Auth: &fakeAuth{stream: stream}}
+	sc, err := c.openSecure(context.Background(), &Session{Key: key})
+	if err != nil {
+		t.Fatalf("openSecure() error = %v", err)
+	}
+
+	fromClient, fromServer, err = channel.Derive(key, stream.sent[0].Random, serverRandom)
+	if err != nil {
+		t.Fatalf("Derive() error = %v", err)
+	}
+
+	return sc, stream, fromClient, fromServer
+}
+
+func TestSecureConnSend(t *testing.T) {
+	sc, stream, fromClient, _ := openPair(t)
+
+	msgs := [][]byte{[]byte("first"), []byte("second"), {}}
+	for _, msg := range msgs {
+		if err := sc.Send(msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	frames := stream.sent[1:]
+	for i, f := range frames {
+		got, err := fromClient.Open(f.Counter, f.Ciphertext)
+		if err != nil {
+			t.Fatalf("server Open() frame %d error = %v", i, err)
+		}
+		if !bytes.Equal(got, msgs[i]) {
+			t.Errorf("server Open() frame %d = %q, want %q", i, got, msgs[i])
+		}
+	}
+
+	// the server refuses a frame it has already opened
+	last := frames[len(frames)-1]
+	if _, err := fromClient.Open(last.Counter, last.Ciphertext); !errors.Is(err, channel.ErrReplay) {
+		t.Errorf("server Open() replayed frame error = %v, want %v", err, channel.ErrReplay)
+	}
+}
+
+func TestSecureConnRecv(t *testing.T) {
+	// frames lists the server's frames by their seal order
+	tests := []struct {
+		name    string
+		frames  []int
+		tamper  bool
+		wantErr []error
+	}{
+		{
+			name:    "in order",
+			frames:  []int{0, 1, 2},
+			wantErr: []error{nil, nil, nil},
+		},
+		{
+			name:    "out of order",
+			frames:  []int{1, 0},
+			wantErr: []error{ErrReplay, nil},
+		},
+		{
+			name:    "replayed",
+			frames:  []int{0, 0, 1},
+			wantErr: []error{nil, ErrReplay, nil},
+		},
+		{
+			name:    "tampered",
+			frames:  []int{0},
+			tamper:  true,
+			wantErr: []error{ErrBadMessage},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, stream, _, fromServer := openPair(t)
+
+			var sealed []*pb.SecureFrame
+			for i := 0; i < 3; i++ {
+				n, ct, err := fromServer.Seal([]byte{byte(i)})
+				if err != nil {
+					t.Fatalf("server Seal() error = %v", err)
+				}
+				if tt.tamper {
+					ct[0] ^= 1
+				}
+				sealed = append(sealed, &pb.SecureFrame{Counter: n, Ciphertext: ct})
+			}
+			for _, i := range tt.frames {
+				stream.recv = append(stream.recv, sealed[i])
+			}
+
+			for i, want := range tt.wantErr {
+				got, err := sc.Recv()
+				if !errors.Is(err, want) {
+					t.Fatalf("Recv() frame %d error = %v, want %v", i, err, want)
+				}
+				if err == nil && !bytes.Equal(got, []byte{byte(tt.frames[i])}) {
+					t.Errorf("Recv() frame %d = %v, want %v", i, got, []byte{byte(tt.frames[i])})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSession is returned when a call needs a session but there is none
+	ErrNoSession = errors.New("not logged in")
+	// ErrPasswordResetRequired is returned by Login when an admin forced a
+	// password reset. The session it stored is only good for ChangePassword
+	// and Logout.
+	ErrPasswordResetRequired = errors.New("password reset required, change the password")
+)
+
+// Session is what a successful login leaves behind
+type Session struct {
+	Username     string    `json:"username"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	// Key is the SRP session key K, it never leaves the process
+	Key []byte `json:"-"`
+	// ResetRequired is set for a session that can only change the password
+	ResetRequired bool `json:"reset_required,omitempty"`
+}
+
+// Expired reports whether the session token has expired, with a little
+// slack so a token does not expire on its way to the server
+func (s *Session) Expired() bool {
+	return time.Now().Add(10 * time.Second).After(s.ExpiresAt)
+}
+
+// TokenStore keeps the current session between calls
+type TokenStore interface {
+	// Load returns the stored session or ErrNoSession
+	Load() (*Session, error)
+	// Save replaces the stored session
+	Save(*Session) error
+	// Clear forgets the stored session
+	Clear() error
+}
+
+// MemoryStore keeps the session in memory, it is the default TokenStore
+type MemoryStore struct {
+	mu      sync.Mutex
+	session *Session
+}
+
+// Load will return the session held in memory
+func (m *MemoryStore) Load() (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.session == nil {
+		return nil, ErrNoSession
+	}
+	c := *m.session
+
+	return &c, nil
+}
+
+// Save will hold a copy of the session in memory
+func (m *MemoryStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *s
+	m.session = &c
+
+	return nil
+}
+
+// Clear will forget the session
+func (m *MemoryStore) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.session = nil
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/1Password/srp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// saltLength is the size, in bytes, of the salts we generate
+const saltLength = 16
+
+// ErrBadServerProof is returned when the server could not prove it knows
+// the session key, which means it does not hold our verifier
+var ErrBadServerProof = errors.New("bad proof from server")
+
+var bigOne = big.NewInt(1)
+
+// groupByLabel will find one of srp.KnownGroups by the label the server sends
+func groupByLabel(label string) (*srp.Group, error) {
+	for _, g := range srp.KnownGroups {
+		if g.Label == label {
+			return g, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown srp group %q", label)
+}
+
+// enrollment is what the server stores in place of a password
+type enrollment struct {
+	salt     string
+	groupID  string
+	verifier string
+	kdf      *pb.KDFParameters
+}
+
+// enroll will pick a fresh salt and compute the verifier for the password
+func enroll(group *srp.Group, k *pb.KDFParameters, username, password string) (*enrollment, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	x, err := deriveX(k, salt, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// the verifier is all the server ever learns about the password
+	client := srp.NewSRPClient(group, x, nil)
+	if client == nil {
+		return nil, errors.New("could not set up srp client")
+	}
+	v, err := client.Verifier()
+	if err != nil {
+		return nil, err
+	}
+
+	return &enrollment{
+		salt:     hex.EncodeToString(salt),
+		groupID:  group.Label,
+		verifier: v.Text(16),
+		kdf:      k,
+	}, nil
+}
+
+// exchange is the client side of a single SRP exchange. The library only
+// takes x in the constructor, which also picks a, but we have to send A
+// before the server tells us the salt and KDF, so we run the client side
+// ourselves.
+//
+// The server runs github.com/1Password/srp v0.2.0, which departs from RFC
+// 5054 in how k, u and K are hashed. The math below matches that version
+// exactly and has to be checked again whenever it is upgraded.
+type exchange struct {
+	group *srp.Group
+	a, A  *big.Int
+	key   []byte
+	proof []byte
+}
+
+// newExchange will pick the ephemeral secret a and compute A = g^a
+func newExchange(group *srp.Group) (*exchange, error) {
+	size := group.ExponentSize
+	if size < srp.MinExponentSize {
+		size = srp.MinExponentSize
+	}
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	a := new(big.Int).SetBytes(secret)
+	if a.Sign() == 0 {
+		return nil, errors.New("could not pick srp secret")
+	}
+
+	return &exchange{
+		group: group,
+		a:     a,
+		A:     new(big.Int).Exp(group.Generator(), a, group.N()),
+	}, nil
+}
+
+// PublicKey returns A in hex for the Login request
+func (e *exchange) PublicKey() string {
+	return e.A.Text(16)
+}
+
+// Prove will compute the session key from the server's reply to Login and
+// return M1 in hex for the Validate request
+func (e *exchange) Prove(username, password string, resp *pb.LoginResponse) (string, error) {
+	salt, err := hex.DecodeString(resp.Salt)
+	if err != nil {
+		return "", fmt.Errorf("malformed salt from server: %w", err)
+	}
+
+	x, err := deriveX(resp.Kdf, salt, username, password)
+	if err != nil {
+		return "", err
+	}
+
+	B, ok := new(big.Int).SetString(resp.ServerPublicKey, 16)
+	if !ok {
+		return "", errors.New("malformed B from server")
+	}
+	// we must check this as defense against a malicious B sent by the server
+	N, g := e.group.N(), e.group.Generator()
+	if new(big.Int).Mod(B, N).Sign() == 0 || new(big.Int).GCD(nil, nil, B, N).Cmp(bigOne) != 0 {
+		return "", errors.New("invalid B from server")
+	}
+
+	// k = H(N | g) and u = H(hex(A) | hex(B)), without padding
+	k := hashInt(N.Bytes(), g.Bytes())
+	u := hashInt([]byte(e.A.Text(16) + B.Text(16)))
+	if u.Sign() == 0 {
+		return "", errors.New("invalid B from server")
+	}
+
+	// S = (B - k * g^x) ^ (a + u * x), K = H(hex(S))
+	base := new(big.Int).Exp(g, x, N)
+	base.Mul(base, k)
+	base.Sub(B, base)
+	base.Mod(base, N)
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, e.a)
+	S := new(big.Int).Exp(base, exp, N)
+	key := sha256.Sum256([]byte(S.Text(16)))
+
+	// M1 = H(H(N) xor H(g), H(I), s, A, B, K) proves we know the key
+	hN, hg := sha256.Sum256(N.Bytes()), sha256.Sum256(g.Bytes())
+	for i := range hN {
+		hN[i] ^= hg[i]
+	}
+	groupHash := sha256.Sum256(hN[:])
+	userHash := sha256.Sum256([]byte(username))
+	h := sha256.New()
+	h.Write(groupHash[:])
+	h.Write(userHash[:])
+	h.Write(salt)
+	h.Write(e.A.Bytes())
+	h.Write(B.Bytes())
+	h.Write(key[:])
+
+	e.key, e.proof = key[:], h.Sum(nil)
+
+	return hex.EncodeToString(e.proof), nil
+}
+
+// Verify will check the server proof M2 = H(A, M1, K) and return K, we do
+// not trust anything the server sent along with it until this passes
+func (e *exchange) Verify(serverProof string) ([]byte, error) {
+	if e.key == nil {
+		return nil, errors.New("no session key, prove first")
+	}
+	proof, err := hex.DecodeString(serverProof)
+	if err != nil {
+		return nil, ErrBadServerProof
+	}
+
+	h := sha256.New()
+	h.Write(e.A.Bytes())
+	h.Write(e.proof)
+	h.Write(e.key)
+	if subtle.ConstantTimeCompare(h.Sum(nil), proof) != 1 {
+		return nil, ErrBadServerProof
+	}
+
+	return e.key, nil
+}
+
+// hashInt returns SHA-256 over the parts as a big int
+func hashInt(parts ...[]byte) *big.Int {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
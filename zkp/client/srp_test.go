@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/1Password/srp"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	srpserver "github.com/imthaghost/goland/zkp/internal/password/srp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// TestExchange runs the client against the server side, which uses the
+// library, so a change in either breaks it
+func TestExchange(t *testing.T) {
+	server, err := srpserver.New(srpserver.RFC5054Group3072, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		group   int
+		kdf     *pb.KDFParameters
+		login   string // the password given at login
+		wantErr error
+	}{
+		{name: "rfc5054", group: srp.RFC5054Group3072, login: "hunter2"},
+		{name: "2048 bit group", group: srp.RFC5054Group2048, login: "hunter2"},
+		{name: "4096 bit group", group: srp.RFC5054Group4096, login: "hunter2"},
+		{
+			name:  "argon2id",
+			group: srp.RFC5054Group3072,
+			kdf:   &pb.KDFParameters{Algorithm: kdf.Argon2id, Iterations: 1, Memory: kdf.MinArgon2Memory, Parallelism: 1},
+			login: "hunter2",
+		},
+		{
+			name:  "pbkdf2",
+			group: srp.RFC5054Group3072,
+			kdf:   &pb.KDFParameters{Algorithm: kdf.PBKDF2, Iterations: kdf.MinPBKDF2Iter},
+			login: "hunter2",
+		},
+		{name: "wrong password", group: srp.RFC5054Group3072, login: "hunter3", wantErr: password.ErrBadProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := srp.KnownGroups[tt.group]
+			en, err := enroll(group, tt.kdf, "alice", "hunter2")
+			if err != nil {
+				t.Fatalf("enroll() error = %v", err)
+			}
+			salt, err := hex.DecodeString(en.salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := srpserver.DecodeInt(en.verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e, err := newExchange(group)
+			if err != nil {
+				t.Fatalf("newExchange() error = %v", err)
+			}
+			A, err := srpserver.DecodeInt(e.PublicKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g, err := server.Group(en.groupID)
+			if err != nil {
+				t.Fatalf("Group(%s) error = %v", en.groupID, err)
+			}
+			session, err := g.NewSession("alice", salt, v, A)
+			if err != nil {
+				t.Fatalf("NewSession() error = %v", err)
+			}
+
+			proof, err := e.Prove("alice", tt.login, &pb.LoginResponse{
+				Salt:            en.salt,
+				ServerPublicKey: srpserver.EncodeInt(session.EphemeralPublic()),
+				Kdf:             en.kdf,
+			})
+			if err != nil {
+				t.Fatalf("Prove() error = %v", err)
+			}
+			m1, err := hex.DecodeString(proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m2, err := session.Verify(m1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("server Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			key, err := e.Verify(hex.EncodeToString(m2))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			serverKey, err := session.Key()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(key, serverKey) {
+				t.Error("client and server session keys differ")
+			}
+
+			// a server that does not hold the verifier can not fake M2
+			m2[0] ^= 1
+			if _, err := e.Verify(hex.EncodeToString(m2)); err != ErrBadServerProof {
+				t.Errorf("Verify() tampered proof error = %v, want %v", err, ErrBadServerProof)
+			}
+		})
+	}
+}
+
+func TestProveRejectsBadB(t *testing.T) {
+	group := srp.KnownGroups[srp.RFC5054Group3072]
+	N := group.N()
+
+	for _, tt := range []struct {
+		name string
+		B    *big.Int
+	}{
+		{"zero", big.NewInt(0)},
+		{"N", N},
+		{"multiple of N", new(big.Int).Mul(N, big.NewInt(3))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newExchange(group)
+			if err != nil {
+				t.Fatalf("newExchange() error = %v", err)
+			}
+			_, err = e.Prove("alice", "hunter2", &pb.LoginResponse{
+				Salt:            "00",
+				ServerPublicKey: tt.B.Text(16),
+			})
+			if err == nil {
+				t.Error("Prove() error = nil, want an error for a bad B")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// SecondFactorRequired is returned by Login when the password was right but
+// the account also wants a TOTP code, pass it to VerifyTOTP with one
+type SecondFactorRequired struct {
+	Challenge string
+	ExpiresAt time.Time
+
+	// session has no tokens yet, only the username and K
+	session *Session
+}
+
+func (e *SecondFactorRequired) Error() string {
+	return "second factor required"
+}
+
+// TOTPEnrollment is a secret waiting to be confirmed with ConfirmTOTP
+type TOTPEnrollment struct {
+	// URI is for authenticator apps, usually shown as a QR code
+	URI string
+	// Secret is base32 encoded, for typing in by hand
+	Secret string
+	// RecoveryCodes each stand in for a code once, they are only shown now
+	RecoveryCodes []string
+}
+
+// VerifyTOTP will finish a login with a TOTP or recovery code and store the
+// new session. A wrong code uses up the challenge, so Login has to be
+// called again. A KDF upgrade the server asked for is left for next time.
+// Like Login it returns ErrPasswordResetRequired when an admin forced a reset.
+func (c *Client) VerifyTOTP(ctx context.Context, pending *SecondFactorRequired, code string) (*Session, error) {
+	session, err := c.verifyTOTP(ctx, pending, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.tokens.Save(session); err != nil {
+		return nil, err
+	}
+	if session.ResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	return session, nil
+}
+
+// verifyTOTP will trade the challenge and code for a session
+func (c *Client) verifyTOTP(ctx context.Context, pending *SecondFactorRequired, code string) (*Session, error) {
+	// a single try, challenges are single use
+	callCtx, cancel := c.callContext(ctx)
+	defer cancel()
+	resp, err := c.Auth.VerifyTOTP(callCtx, &pb.VerifyTOTPRequest{
+		Challenge: pending.Challenge,
+		Code:      code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := *pending.session
+	s.Token = resp.Token
+	s.ExpiresAt = time.Unix(resp.ExpiresAt, 0)
+	s.RefreshToken = resp.RefreshToken
+	s.ResetRequired = resp.PasswordResetRequired
+
+	return &s, nil
+}
+
+// EnrollTOTP will start enrolling a second factor for the logged in user,
+// logins only ask for a code once it is confirmed with ConfirmTOTP
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	ctx, err := c.AuthContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *pb.EnrollTOTPResponse
+	err = c.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Auth.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		URI:           resp.Uri,
+		Secret:        resp.Secret,
+		RecoveryCodes: resp.RecoveryCodes,
+	}, nil
+}
+
+// ConfirmTOTP will finish enrolling a second factor with a first code
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) error {
+	ctx, err := c.AuthContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, func(ctx context.Context) error {
+		_, err := c.Auth.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: code})
+		return err
+	})
+}
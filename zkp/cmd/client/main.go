@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/imthaghost/goland/zkp/client"
+)
+
+const (
+	username    = "imthaghost"
+	password    = "Fido1961!"
+	newPassword = "Rex1962?"
+)
+
+func main() {
+
+	c, err := client.Dial("localhost:8080", client.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+
+	if err := c.Register(ctx, username, password); err != nil {
+		log.Fatal(err)
+	}
+
+	// some time later we actually want to authenticate
+	session, err := c.Login(ctx, username, password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("logged in as %s until %s", session.Username, session.ExpiresAt)
+
+	// changing the password is just enrolling again, the new verifier
+	// replaces the old one and every other session is ended
+	if _, err := c.ChangePassword(ctx, newPassword); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := c.Login(ctx, username, password); err == nil {
+		log.Fatal("old password still works")
+	}
+	session, err = c.Login(ctx, username, newPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("logged in as %s until %s", session.Username, session.ExpiresAt)
+
+	if err := c.Logout(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,27 +1,354 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/imthaghost/goland/zkp/internal/accesslog"
 	"github.com/imthaghost/goland/zkp/internal/api"
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/audit/fanout"
+	"github.com/imthaghost/goland/zkp/internal/audit/jsonl"
+	"github.com/imthaghost/goland/zkp/internal/channel"
+	chinmemory "github.com/imthaghost/goland/zkp/internal/channel/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/config"
+	"github.com/imthaghost/goland/zkp/internal/gateway"
+	hsinmemory "github.com/imthaghost/goland/zkp/internal/handshake/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/health"
+	"github.com/imthaghost/goland/zkp/internal/metrics"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
+	zkpserver "github.com/imthaghost/goland/zkp/internal/server"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/store/boltdb"
 	"github.com/imthaghost/goland/zkp/internal/store/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/store/sealed"
+	"github.com/imthaghost/goland/zkp/internal/token/keyring"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run will serve until SIGINT or SIGTERM, it returns instead of exiting so
+// the deferred closes run on every path
+func run() error {
+	cs := &config.New{}
+	cs.Load()
+	cfg := cs.Get()
+
+	// flags win over the environment
+	sc := &cfg.ServerConfig
+	flag.StringVar(&sc.Addr, "addr", sc.Addr, "address to listen on (SERVER_ADDR)")
+	flag.StringVar(&sc.TLSCertFile, "tls-cert", sc.TLSCertFile, "TLS certificate (TLS_CERT_FILE)")
+	flag.StringVar(&sc.TLSKeyFile, "tls-key", sc.TLSKeyFile, "TLS key (TLS_KEY_FILE)")
+	flag.StringVar(&sc.ClientCAFile, "tls-client-ca", sc.ClientCAFile, "CA that client certificates must be signed by (TLS_CLIENT_CA_FILE)")
+	flag.DurationVar(&sc.KeepaliveTime, "keepalive-time", sc.KeepaliveTime, "ping idle clients this often (KEEPALIVE_TIME)")
+	flag.DurationVar(&sc.KeepaliveTimeout, "keepalive-timeout", sc.KeepaliveTimeout, "drop clients that do not answer a ping within this (KEEPALIVE_TIMEOUT)")
+	flag.DurationVar(&sc.KeepaliveMinTime, "keepalive-min-time", sc.KeepaliveMinTime, "the most often clients may ping (KEEPALIVE_MIN_TIME)")
+	flag.IntVar(&sc.MaxRecvMsgSize, "max-recv-msg-size", sc.MaxRecvMsgSize, "largest message accepted, in bytes (MAX_RECV_MSG_SIZE)")
+	flag.IntVar(&sc.MaxSendMsgSize, "max-send-msg-size", sc.MaxSendMsgSize, "largest message sent, in bytes (MAX_SEND_MSG_SIZE)")
+	gc := &cfg.GatewayConfig
+	flag.StringVar(&gc.Addr, "gateway-addr", gc.Addr, "address for the HTTP/JSON gateway, off when empty (GATEWAY_ADDR)")
+	flag.StringVar(&gc.TLSCertFile, "gateway-tls-cert", gc.TLSCertFile, "gateway TLS certificate, defaults to -tls-cert (GATEWAY_TLS_CERT_FILE)")
+	flag.StringVar(&gc.TLSKeyFile, "gateway-tls-key", gc.TLSKeyFile, "gateway TLS key, defaults to -tls-key (GATEWAY_TLS_KEY_FILE)")
+	flag.StringVar(&gc.ClientCAFile, "gateway-tls-client-ca", gc.ClientCAFile, "CA that gateway client certificates are checked against when presented (GATEWAY_TLS_CLIENT_CA_FILE)")
+	flag.StringVar(&cfg.MetricsConfig.Addr, "metrics-addr", cfg.MetricsConfig.Addr, "address serving /metrics, off when empty (METRICS_ADDR)")
+	flag.DurationVar(&sc.ShutdownTimeout, "shutdown-timeout", sc.ShutdownTimeout, "time in-flight calls get to finish on shutdown (SHUTDOWN_TIMEOUT)")
+	flag.Parse()
+
+	serverOpts, err := zkpserver.Options(cfg.ServerConfig, cfg.General.AppEnv)
+	if err != nil {
+		return fmt.Errorf("failed to configure server: %w", err)
+	}
+
+	var ss store.Service
+	switch cfg.StoreConfig.Backend {
+	case config.MEMORY:
+		ss = inmemory.New()
+	case config.BOLT:
+		db, err := boltdb.New(cfg.StoreConfig.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %w", err)
+		}
+		defer db.Close()
+		ss = db
+	default:
+		return fmt.Errorf("unknown store backend %q", cfg.StoreConfig.Backend)
+	}
 
-	ss := inmemory.New()
+	// the master key must never be kept with the data it protects
+	var sealedStore *sealed.Store
+	if masterKeys := cfg.StoreConfig.MasterKey; masterKeys != "" || cfg.StoreConfig.MasterKeyFile != "" {
+		if cfg.StoreConfig.MasterKeyFile != "" {
+			b, err := os.ReadFile(cfg.StoreConfig.MasterKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read master key: %w", err)
+			}
+			masterKeys = string(b)
+		}
+		keys, err := sealed.ParseMasterKeys(masterKeys)
+		if err != nil {
+			return fmt.Errorf("failed to read master key: %w", err)
+		}
+		sealedStore, err = sealed.New(ss, keys)
+		if err != nil {
+			return fmt.Errorf("failed to set up sealing: %w", err)
+		}
+		ss = sealedStore
+	} else {
+		dks, err := ss.ListDataKeys()
+		if err != nil {
+			return fmt.Errorf("failed to read store: %w", err)
+		}
+		if len(dks) > 0 {
+			return errors.New("the store is sealed, STORE_MASTER_KEY or STORE_MASTER_KEY_FILE is required")
+		}
+	}
+
+	// reencrypt seals every user with a new data key, stop the server first
+	switch flag.Arg(0) {
+	case "":
+	case "reencrypt":
+		if sealedStore == nil {
+			return errors.New("reencrypt needs STORE_MASTER_KEY or STORE_MASTER_KEY_FILE")
+		}
+		n, err := sealedStore.Reencrypt()
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt: %w", err)
+		}
+		log.Printf("re-encrypted %d users", n)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", flag.Arg(0))
+	}
 
-	lis, err := net.Listen("tcp", "localhost:8080")
+	group, err := srp.GroupForBits(cfg.PasswordConfig.DefaultGroupBits)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to set up srp: %w", err)
+	}
+	ps, err := srp.New(group, cfg.PasswordConfig.MinGroupBits)
+	if err != nil {
+		return fmt.Errorf("failed to set up srp: %w", err)
+	}
+
+	hs := hsinmemory.New(cfg.HandshakeConfig.TTL)
+	defer hs.Close()
+	// logins waiting for a second factor are kept like handshakes, only longer
+	challenges := hsinmemory.New(cfg.TOTPConfig.ChallengeTTL)
+	defer challenges.Close()
+	// SRP session keys for SecureExchange never leave memory, after a
+	// restart clients have to log in again to use it
+	sessionKeys := chinmemory.New()
+	defer sessionKeys.Close()
+
+	// without a keys directory every restart invalidates all tokens
+	var keys map[string]ed25519.PrivateKey
+	signingID := cfg.TokenConfig.SigningKeyID
+	if cfg.TokenConfig.KeysDir != "" {
+		keys, signingID, err = keyring.Load(cfg.TokenConfig.KeysDir, signingID)
+		if err != nil {
+			return fmt.Errorf("failed to load token keys: %w", err)
+		}
+	} else if cfg.General.AppEnv != config.DEV {
+		return fmt.Errorf("TOKEN_KEYS_DIR is required outside of %s", config.DEV)
+	}
+	ts, err := keyring.New(keys, signingID, cfg.TokenConfig.Issuer, cfg.TokenConfig.TTL)
+	if err != nil {
+		return fmt.Errorf("failed to set up token keyring: %w", err)
+	}
+
+	rl := cfg.RateLimitConfig
+	limiter := ratelimit.New(ratelimit.Config{
+		PeerRate:         rl.PeerRate,
+		PeerBurst:        rl.PeerBurst,
+		UserRate:         rl.UserRate,
+		UserBurst:        rl.UserBurst,
+		LockoutThreshold: rl.LockoutThreshold,
+		LockoutBase:      rl.LockoutBase,
+		LockoutMax:       rl.LockoutMax,
+	})
+
+	// the gateway runs the same unary interceptors as the gRPC server, the
+	// access log goes first so everything after it sees the request ID
+	var interceptors []grpc.UnaryServerInterceptor
+	var streamInterceptors []grpc.StreamServerInterceptor
+	if cfg.AccessLogConfig.Enabled {
+		al, err := accesslog.New(os.Stdout, []byte(cfg.AccessLogConfig.HashKey))
+		if err != nil {
+			return fmt.Errorf("failed to set up access log: %w", err)
+		}
+		interceptors = append(interceptors, al.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, al.StreamServerInterceptor())
+	}
+	m := metrics.New()
+	interceptors = append(interceptors,
+		m.UnaryServerInterceptor(),
+		ratelimit.UnaryServerInterceptor(limiter,
+			"/auth.Auth/Register",
+			"/auth.Auth/Login",
+			"/auth.Auth/Validate",
+			"/auth.Auth/RefreshToken",
+			"/auth.Auth/ChangeVerifier",
+			"/auth.Auth/VerifyTOTP",
+		),
+	)
+	streamInterceptors = append(streamInterceptors, m.StreamServerInterceptor())
+	opts := append(serverOpts,
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+	server := api.New(ss, ps, hs, ts)
+	server.RefreshTTL = cfg.TokenConfig.RefreshTTL
+	server.ChallengeService = challenges
+	// embedders bring their own handler, on its own the server echoes
+	server.KeyService = sessionKeys
+	server.SecureHandler = channel.Echo{}
+	server.TOTPIssuer = cfg.TOTPConfig.Issuer
+	if err := cfg.PasswordConfig.KDF.Validate(); err != nil {
+		return fmt.Errorf("invalid KDF policy: %w", err)
 	}
-	var opts []grpc.ServerOption
-	server := api.New(ss)
+	server.KDFPolicy = cfg.PasswordConfig.KDF
+	server.Limiter = limiter
+
+	// without a stable secret the made up salts change on every restart,
+	// which gives away which usernames do not exist
+	decoySecret := []byte(cfg.HandshakeConfig.DecoySecret)
+	if len(decoySecret) == 0 {
+		if cfg.General.AppEnv != config.DEV {
+			return fmt.Errorf("DECOY_SECRET is required outside of %s", config.DEV)
+		}
+		decoySecret = make([]byte, 32)
+		if _, err := rand.Read(decoySecret); err != nil {
+			return fmt.Errorf("failed to generate decoy secret: %w", err)
+		}
+	}
+	server.DecoyFloor = cfg.HandshakeConfig.DecoyFloor
+	if err := server.EnableDecoys(decoySecret); err != nil {
+		return fmt.Errorf("failed to set up decoys: %w", err)
+	}
+
+	feed := fanout.New()
+	sinks := []audit.Sink{feed}
+	if f := cfg.AuditConfig.File; f != "" {
+		auditFile, err := jsonl.New(f, cfg.AuditConfig.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		defer auditFile.Close()
+		sinks = append(sinks, auditFile)
+	}
+	server.AuditService = audit.New(sinks...)
+	server.EventFeed = feed
+	server.Admins = api.Admins{
+		Users:       cfg.AdminConfig.Users,
+		ClientNames: cfg.AdminConfig.ClientNames,
+		Token:       cfg.AdminConfig.Token,
+	}
+
+	hc := health.New()
+	hc.AddService(api.ServiceName, health.StoreProbe(ss), health.KeystoreProbe(ts))
+	hc.AddService(api.AdminServiceName, health.StoreProbe(ss))
+	server.HealthService = hc
+
 	grpcServer := grpc.NewServer(opts...)
 	pb.RegisterAuthServer(grpcServer, server)
-	grpcServer.Serve(lis)
+	pb.RegisterAdminServer(grpcServer, api.NewAdminServer(server))
+	healthpb.RegisterHealthServer(grpcServer, hc)
+	reflection.Register(grpcServer)
+
+	lis, err := net.Listen("tcp", sc.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	if sc.TLSCertFile == "" {
+		log.Printf("serving plaintext on %s, only do this in %s", lis.Addr(), config.DEV)
+	} else {
+		log.Printf("serving on %s", lis.Addr())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go hc.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		feed.Close()
+	}()
+
+	// the HTTP servers stop along with the gRPC one, and take it down if they fail
+	var httpServers sync.WaitGroup
+	serveHTTP := func(name, addr string, httpServer *http.Server) error {
+		hlis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		log.Printf("serving %s on %s", name, hlis.Addr())
+
+		httpServers.Add(1)
+		go func() {
+			defer httpServers.Done()
+			if err := zkpserver.ServeHTTP(ctx, httpServer, hlis, sc.ShutdownTimeout); err != nil {
+				log.Printf("%s failed: %v", name, err)
+				stop()
+			}
+		}()
+		return nil
+	}
+
+	if gc.Addr != "" {
+		tlsConfig, err := zkpserver.GatewayTLSConfig(*gc, *sc)
+		if err != nil {
+			return fmt.Errorf("failed to configure gateway: %w", err)
+		}
+		err = serveHTTP("gateway", gc.Addr, &http.Server{
+			Handler: gateway.New(server, gateway.CORS{
+				AllowedOrigins: gc.CORSOrigins,
+				MaxAge:         gc.CORSMaxAge,
+			}, interceptors...),
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// metrics go on their own port so they can stay off the public network
+	if addr := cfg.MetricsConfig.Addr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		err := serveHTTP("metrics", addr, &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zkpserver.Serve(ctx, grpcServer, lis, sc.ShutdownTimeout); err != nil {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	httpServers.Wait()
+	log.Println("stopped")
+	return nil
 }
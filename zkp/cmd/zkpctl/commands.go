@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/client"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// cmdEnv is what every command gets to work with
+type cmdEnv struct {
+	opts   *options
+	client *client.Client
+	prompt *prompt
+}
+
+// command is a single subcommand
+type command func(ctx context.Context, e *cmdEnv, args []string) error
+
+var commands = map[string]command{
+	"register":        register,
+	"login":           login,
+	"whoami":          whoami,
+	"change-password": changePassword,
+	"enroll-totp":     enrollTOTP,
+	"logout":          logout,
+}
+
+// sessionOutput is what login and change-password print
+type sessionOutput struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// register will enroll a new user
+func register(ctx context.Context, e *cmdEnv, args []string) error {
+	username, err := usernameArg(args)
+	if err != nil {
+		return err
+	}
+	password, err := e.prompt.newPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := e.client.Register(ctx, username, password); err != nil {
+		return err
+	}
+
+	e.print(map[string]string{"username": username}, fmt.Sprintf("registered %s", username))
+	return nil
+}
+
+// login will log in and cache the session
+func login(ctx context.Context, e *cmdEnv, args []string) error {
+	username, err := usernameArg(args)
+	if err != nil {
+		return err
+	}
+	password, err := e.prompt.password("Password: ")
+	if err != nil {
+		return err
+	}
+
+	s, err := e.client.Login(ctx, username, password)
+	if errors.Is(err, client.ErrPasswordResetRequired) {
+		fmt.Fprintln(os.Stderr, "an administrator requires a new password")
+		if password, err = e.prompt.newPassword("New password: "); err != nil {
+			return err
+		}
+		s, err = e.client.ChangePassword(ctx, password)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.print(sessionOutput{s.Username, s.ExpiresAt}, fmt.Sprintf("logged in as %s until %s", s.Username, s.ExpiresAt.Format(time.RFC1123)))
+	return nil
+}
+
+// whoami will ask the server who the cached session belongs to
+func whoami(ctx context.Context, e *cmdEnv, args []string) error {
+	s, err := e.client.Session(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Auth.IntrospectToken(ctx, &pb.IntrospectTokenRequest{Token: s.Token})
+	if err != nil {
+		return err
+	}
+	if !resp.Active {
+		return errors.New("session is no longer active, log in again")
+	}
+
+	out := struct {
+		Username  string    `json:"username"`
+		SessionID string    `json:"session_id"`
+		IssuedAt  time.Time `json:"issued_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{resp.Username, resp.SessionId, time.Unix(resp.IssuedAt, 0), time.Unix(resp.ExpiresAt, 0)}
+	e.print(out, fmt.Sprintf("%s (session %s, expires %s)", out.Username, out.SessionID, out.ExpiresAt.Format(time.RFC1123)))
+	return nil
+}
+
+// changePassword will enroll the logged in user with a new password
+func changePassword(ctx context.Context, e *cmdEnv, args []string) error {
+	password, err := e.prompt.newPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	s, err := e.client.ChangePassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	e.print(sessionOutput{s.Username, s.ExpiresAt}, fmt.Sprintf("changed password of %s, every other session has been logged out", s.Username))
+	return nil
+}
+
+// enrollTOTP will enroll a second factor for the logged in user, confirming
+// it with a code from their authenticator app
+func enrollTOTP(ctx context.Context, e *cmdEnv, args []string) error {
+	enrollment, err := e.client.EnrollTOTP(ctx)
+	if err != nil {
+		return err
+	}
+
+	if e.opts.json {
+		printJSON(map[string]interface{}{
+			"uri":            enrollment.URI,
+			"secret":         enrollment.Secret,
+			"recovery_codes": enrollment.RecoveryCodes,
+		})
+	} else {
+		fmt.Printf("Add this to your authenticator app:\n\n  %s\n\nor type in the secret %s\n\n", enrollment.URI, enrollment.Secret)
+		fmt.Println("Recovery codes, each works once in place of a code. Keep them safe, they are not shown again:")
+		for _, c := range enrollment.RecoveryCodes {
+			fmt.Printf("  %s\n", c)
+		}
+		fmt.Println()
+	}
+
+	code, err := e.prompt.line("Code from your authenticator app: ")
+	if err != nil {
+		return err
+	}
+	if err := e.client.ConfirmTOTP(ctx, code); err != nil {
+		return err
+	}
+
+	e.print(map[string]bool{"confirmed": true}, "second factor enrolled, logins will ask for a code")
+	return nil
+}
+
+// logout will end the cached session
+func logout(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := e.client.Logout(ctx); err != nil {
+		return err
+	}
+
+	e.print(map[string]bool{"logged_out": true}, "logged out")
+	return nil
+}
+
+// usernameArg returns the single username argument
+func usernameArg(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errors.New("expected a username")
+	}
+
+	return args[0], nil
+}
+
+// print writes v as JSON or the human readable line, depending on --json
+func (e *cmdEnv) print(v interface{}, human string) {
+	if e.opts.json {
+		printJSON(v)
+		return
+	}
+
+	fmt.Println(human)
+}
+
+// printJSON writes v to stdout as a single line of JSON
+func printJSON(v interface{}) {
+	json.NewEncoder(os.Stdout).Encode(v)
+}
@@ -0,0 +1,182 @@
+// zkpctl is a command line client for the Auth service.
+//
+//	zkpctl [flags] register <username>
+//	zkpctl [flags] login <username>
+//	zkpctl [flags] whoami
+//	zkpctl [flags] change-password
+//	zkpctl [flags] enroll-totp
+//	zkpctl [flags] logout
+//
+// Every flag can also be set in the environment, flags win.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/client"
+
+	"google.golang.org/grpc/status"
+)
+
+// options are the global flags
+type options struct {
+	addr          string
+	tenant        string
+	insecure      bool
+	caFile        string
+	certFile      string
+	keyFile       string
+	serverName    string
+	credentials   string
+	json          bool
+	passwordStdin bool
+	timeout       time.Duration
+}
+
+func main() {
+	opts := &options{}
+	fs := flag.NewFlagSet("zkpctl", flag.ExitOnError)
+	fs.StringVar(&opts.addr, "addr", env("ZKP_ADDR", "localhost:8080"), "server address (ZKP_ADDR)")
+	fs.StringVar(&opts.tenant, "tenant", env("ZKP_TENANT", ""), "tenant the user belongs to, the server's default when empty (ZKP_TENANT)")
+	fs.BoolVar(&opts.insecure, "insecure", envBool("ZKP_INSECURE"), "connect without TLS (ZKP_INSECURE)")
+	fs.StringVar(&opts.caFile, "ca-file", env("ZKP_CA_FILE", ""), "CA certificate to verify the server with (ZKP_CA_FILE)")
+	fs.StringVar(&opts.certFile, "cert-file", env("ZKP_CERT_FILE", ""), "client certificate for mTLS (ZKP_CERT_FILE)")
+	fs.StringVar(&opts.keyFile, "key-file", env("ZKP_KEY_FILE", ""), "client key for mTLS (ZKP_KEY_FILE)")
+	fs.StringVar(&opts.serverName, "server-name", env("ZKP_SERVER_NAME", ""), "name to verify the server certificate against (ZKP_SERVER_NAME)")
+	fs.StringVar(&opts.credentials, "credentials", env("ZKP_CREDENTIALS", defaultCredentials()), "file to cache tokens in (ZKP_CREDENTIALS)")
+	fs.BoolVar(&opts.json, "json", envBool("ZKP_JSON"), "print JSON (ZKP_JSON)")
+	fs.BoolVar(&opts.passwordStdin, "password-stdin", false, "read passwords from stdin, one per line")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "deadline for the whole command")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: zkpctl [flags] <register|login|whoami|change-password|enroll-totp|logout> [username]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(opts, cmd, args[1:]); err != nil {
+		fail(opts, err)
+	}
+}
+
+// run will dial the server and run cmd
+func run(opts *options, cmd command, args []string) error {
+	dialOpts, err := opts.dialOptions()
+	if err != nil {
+		return err
+	}
+	p := newPrompt(opts.passwordStdin)
+	dialOpts = append(dialOpts, client.WithTOTPPrompt(func(ctx context.Context) (string, error) {
+		return p.line("Code: ")
+	}))
+	c, err := client.Dial(opts.addr, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	return cmd(ctx, &cmdEnv{opts: opts, client: c, prompt: p}, args)
+}
+
+// dialOptions turns the flags into client options
+func (o *options) dialOptions() ([]client.Option, error) {
+	opts := []client.Option{
+		client.WithTokenStore(client.NewFileStore(o.credentials)),
+		client.WithTenant(o.tenant),
+	}
+	if o.insecure {
+		return append(opts, client.WithInsecure()), nil
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.serverName,
+	}
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", o.caFile)
+		}
+	}
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return append(opts, client.WithTLS(config)), nil
+}
+
+// defaultCredentials is where tokens are cached when nothing else is set
+func defaultCredentials() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".zkp-credentials.json"
+	}
+
+	return filepath.Join(dir, "zkp", "credentials.json")
+}
+
+// env returns the environment variable key or def when it is unset
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// envBool returns whether the environment variable key is set to true
+func envBool(key string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(key))
+	return b
+}
+
+// fail will report err and exit
+func fail(opts *options, err error) {
+	msg := err.Error()
+	if st, ok := status.FromError(err); ok {
+		msg = st.Message()
+	}
+
+	if opts.json {
+		printJSON(map[string]string{"error": msg})
+	} else {
+		fmt.Fprintf(os.Stderr, "zkpctl: %s\n", msg)
+	}
+
+	if errors.Is(err, client.ErrNoSession) {
+		os.Exit(3)
+	}
+	os.Exit(1)
+}
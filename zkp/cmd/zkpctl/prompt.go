@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// prompt reads passwords from the terminal without echo, or from stdin when
+// it is not a terminal
+type prompt struct {
+	stdin    *bufio.Reader
+	terminal bool
+}
+
+// newPrompt will create a new prompt, forceStdin reads stdin even on a terminal
+func newPrompt(forceStdin bool) *prompt {
+	return &prompt{
+		stdin:    bufio.NewReader(os.Stdin),
+		terminal: !forceStdin && term.IsTerminal(int(os.Stdin.Fd())),
+	}
+}
+
+// password will read a single password
+func (p *prompt) password(label string) (string, error) {
+	if !p.terminal {
+		line, err := p.stdin.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("could not read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, label)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("could not read password: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// line will read a single line that may be shown, such as a TOTP code
+func (p *prompt) line(label string) (string, error) {
+	if p.terminal {
+		fmt.Fprint(os.Stderr, label)
+	}
+	line, err := p.stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("could not read %s: %w", strings.TrimSuffix(strings.ToLower(label), ": "), err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// newPassword will read a password that is about to be set, on a terminal
+// it has to be typed twice
+func (p *prompt) newPassword(label string) (string, error) {
+	password, err := p.password(label)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+	if !p.terminal {
+		return password, nil
+	}
+
+	again, err := p.password("Repeat password: ")
+	if err != nil {
+		return "", err
+	}
+	if again != password {
+		return "", errors.New("passwords do not match")
+	}
+
+	return password, nil
+}
@@ -0,0 +1,208 @@
+// Package accesslog writes one JSON line per RPC. Lines carry a request ID
+// taken from the x-request-id metadata, or made up when there is none, and a
+// keyed hash of the username instead of the username itself. Messages,
+// tokens, proofs and other request fields are never logged.
+package accesslog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key request IDs are read from and echoed in
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength is the longest request ID we take from a client,
+// anything longer is replaced
+const maxRequestIDLength = 128
+
+// usernameRequest is any request that names the account it acts on
+type usernameRequest interface {
+	GetUsername() string
+}
+
+// entry is a single line of the access log
+type entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Code       string    `json:"code"`
+	DurationMS float64   `json:"duration_ms"`
+	Peer       string    `json:"peer,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	User       string    `json:"user,omitempty"`
+}
+
+// Logger writes access log lines
+type Logger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	key []byte
+}
+
+// New will create a new Logger writing to w. Usernames are hashed with key,
+// which should be kept stable so lines about the same user can be matched
+// across restarts; a random one is used when it is empty.
+func New(w io.Writer, key []byte) (*Logger, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Logger{
+		enc: json.NewEncoder(w),
+		key: key,
+	}, nil
+}
+
+// requestIDContextKey is where the request ID is kept in the context
+type requestIDContextKey struct{}
+
+// RequestID returns the request ID of the call, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// UnaryServerInterceptor logs every unary RPC once it has been handled
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, id := withRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+		resp, err := handler(ctx, req)
+
+		var username string
+		if r, ok := req.(usernameRequest); ok {
+			username = r.GetUsername()
+		}
+		l.write(ctx, id, info.FullMethod, tenant.FromContext(ctx, req), username, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs every streaming RPC once it has ended
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, id := withRequestID(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIDKey, id))
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		l.write(ctx, id, info.FullMethod, tenant.FromMetadata(ctx), "", start, err)
+
+		return err
+	}
+}
+
+// serverStream is a grpc.ServerStream carrying the request ID in its context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// write will log a single finished RPC
+func (l *Logger) write(ctx context.Context, id, method, tenantID, username string, start time.Time, err error) {
+	// tenants come straight from the caller, the server turns bad ones away
+	if tenant.Validate(tenantID) != nil {
+		tenantID = ""
+	}
+	e := entry{
+		Time:       start.UTC(),
+		RequestID:  id,
+		Method:     method,
+		Code:       status.Code(err).String(),
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Peer:       peerHost(ctx),
+		Tenant:     tenantID,
+	}
+	// the same username in two tenants is two different people
+	if username != "" {
+		e.User = l.HashUsername(tenant.Key(tenantID, username))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(e); err != nil {
+		log.Printf("could not write access log: %v", err)
+	}
+}
+
+// HashUsername returns the keyed hash usernames are logged as
+func (l *Logger) HashUsername(username string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(username))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// withRequestID returns the context carrying the caller's request ID, or a
+// new one when they did not send a usable one
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(RequestIDKey); len(v) > 0 && validRequestID(v[0]) {
+		id = v[0]
+	} else {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err == nil {
+			id = hex.EncodeToString(b)
+		}
+	}
+
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+// validRequestID makes sure a request ID is short and printable ASCII, so it
+// can not be used to forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// peerHost returns the host of the caller without its port
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,159 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// secrets the auth stub hands out, none of them may reach the log
+const (
+	publicKey = "a1b2c3d4e5f6"
+	proof     = "f00dfeedbeef"
+	token     = "eyJhbGciOiJFZERTQSJ9.secret-token"
+	refresh   = "refresh-secret"
+)
+
+// auth answers Login and Validate with made up secrets
+type auth struct {
+	pb.UnimplementedAuthServer
+}
+
+func (auth) Login(ctx context.Context, request *pb.LoginRequest) (*pb.LoginResponse, error) {
+	return &pb.LoginResponse{Salt: "73616c74", ServerPublicKey: publicKey, HandshakeId: "handshake"}, nil
+}
+
+func (auth) Validate(ctx context.Context, request *pb.ValidateRequest) (*pb.ValidateResponse, error) {
+	return &pb.ValidateResponse{ServerProof: proof, Token: token, RefreshToken: refresh}, nil
+}
+
+// serve will serve the auth stub behind the logger until the test ends
+func serve(t *testing.T, l *Logger) pb.AuthClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(grpc.UnaryInterceptor(l.UnaryServerInterceptor()))
+	pb.RegisterAuthServer(gs, auth{})
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewAuthClient(conn)
+}
+
+// lines decodes every line written to buf
+func lines(t *testing.T, buf *bytes.Buffer) []entry {
+	t.Helper()
+
+	var entries []entry
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		var e entry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("access log line does not decode: %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+func TestNothingSecretIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, []byte("key"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c := serve(t, l)
+	ctx := context.Background()
+
+	if _, err := c.Login(ctx, &pb.LoginRequest{Username: "alice", PublicKey: publicKey}); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, err := c.Validate(ctx, &pb.ValidateRequest{HandshakeId: "handshake", Proof: proof}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, secret := range []string{"alice", publicKey, proof, token, refresh, "73616c74"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("access log has %q in it:\n%s", secret, buf.String())
+		}
+	}
+
+	entries := lines(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("access log has %d lines, want 2", len(entries))
+	}
+	if got, want := entries[0].User, l.HashUsername("alice"); got != want {
+		t.Errorf("Login line user = %q, want %q", got, want)
+	}
+	for _, e := range entries {
+		if e.RequestID == "" || e.Code != "OK" {
+			t.Errorf("line = %+v, want a request ID and code OK", e)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		kept bool
+	}{
+		{"kept", "req-123", true},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"with a space", "req 123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := New(&buf, nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			c := serve(t, l)
+
+			var header metadata.MD
+			ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, tt.id)
+			if _, err := c.Login(ctx, &pb.LoginRequest{Username: "alice"}, grpc.Header(&header)); err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			entries := lines(t, &buf)
+			if len(entries) != 1 {
+				t.Fatalf("access log has %d lines, want 1", len(entries))
+			}
+			got := entries[0].RequestID
+			if (got == tt.id) != tt.kept {
+				t.Errorf("logged request ID = %q, sent %q, want kept %v", got, tt.id, tt.kept)
+			}
+			if !validRequestID(got) {
+				t.Errorf("logged request ID %q is not a valid one", got)
+			}
+			if echoed := header.Get(RequestIDKey); len(echoed) != 1 || echoed[0] != got {
+				t.Errorf("echoed request ID = %v, want %q", echoed, got)
+			}
+		})
+	}
+}
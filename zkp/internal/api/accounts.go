@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPageSize is how many users ListUsers returns when not asked for a number
+	defaultPageSize = 100
+	// maxPageSize is the most users ListUsers returns at once
+	maxPageSize = 1000
+	// maxLockReasonLength is the longest reason an account can be locked for
+	maxLockReasonLength = 256
+)
+
+// AdminServer is the Admin service. It shares the Auth service's stores and
+// admins, every call needs an admin credential.
+type AdminServer struct {
+	s *Server
+
+	pb.UnimplementedAdminServer
+}
+
+// NewAdminServer will create the Admin service for s
+func NewAdminServer(s *Server) *AdminServer {
+	return &AdminServer{s: s}
+}
+
+// ListUsers pages through the users of a tenant, optionally only those
+// whose username contains the query
+func (a *AdminServer) ListUsers(ctx context.Context, request *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	if _, err := a.s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	t, err := a.s.getTenant(request.TenantId)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(request.PageSize)
+	if size < 0 {
+		return nil, invalidArgument("page_size", "page size cannot be negative")
+	}
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	after, err := base64.RawURLEncoding.DecodeString(request.PageToken)
+	if err != nil {
+		return nil, invalidArgument("page_token", "malformed page token")
+	}
+
+	// one more than asked for tells us whether there is another page
+	users, err := a.s.StoreService.SearchUsers(t.ID, store.UserQuery{
+		Contains: request.Query,
+		After:    string(after),
+		Limit:    size + 1,
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not list users")
+	}
+
+	resp := pb.ListUsersResponse{}
+	if len(users) > size {
+		users = users[:size]
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(users[size-1].Username))
+	}
+	for _, u := range users {
+		resp.Users = append(resp.Users, a.account(t, u))
+	}
+	return &resp, nil
+}
+
+// GetUser shows the state of an account
+func (a *AdminServer) GetUser(ctx context.Context, request *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	if _, err := a.s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	t, err := a.s.getTenant(request.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUsername(request.Username); err != nil {
+		return nil, err
+	}
+
+	u, err := a.s.StoreService.GetUserByUsername(t.ID, request.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, userError(codes.NotFound, request.Username, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve user")
+	}
+
+	return &pb.GetUserResponse{User: a.account(t, u)}, nil
+}
+
+// LockUser ends every session of an account and refuses its logins until
+// it is unlocked
+func (a *AdminServer) LockUser(ctx context.Context, request *pb.LockUserRequest) (*pb.LockUserResponse, error) {
+	admin, err := a.s.authorizeAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	if len(request.Reason) > maxLockReasonLength {
+		return nil, invalidArgument("reason", "reason is too long")
+	}
+
+	t, u, err := a.modify(request.TenantId, request.Username, func(u *store.User) error {
+		u.Lock = &store.Lock{
+			Reason: request.Reason,
+			By:     admin,
+			At:     time.Now().UTC().Truncate(time.Second),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := a.s.endSessions(t, u.Username); err != nil {
+		return nil, err
+	}
+	detail := map[string]string{"admin": admin}
+	if request.Reason != "" {
+		detail["reason"] = request.Reason
+	}
+	a.s.emit(ctx, t.ID, audit.AdminLocked, u.Username, "", detail)
+
+	return &pb.LockUserResponse{User: a.account(t, u)}, nil
+}
+
+// UnlockUser lifts an admin lock and any lockout for bad proofs
+func (a *AdminServer) UnlockUser(ctx context.Context, request *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	admin, err := a.s.authorizeAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+
+	t, u, err := a.modify(request.TenantId, request.Username, func(u *store.User) error {
+		u.Lock = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.s.Limiter.Success(tenant.Key(t.ID, u.Username))
+	a.s.emit(ctx, t.ID, audit.AdminUnlocked, u.Username, "", map[string]string{"admin": admin})
+
+	return &pb.UnlockUserResponse{User: a.account(t, u)}, nil
+}
+
+// ForcePasswordReset ends every session of an account, its next login only
+// earns a token to change the password with
+func (a *AdminServer) ForcePasswordReset(ctx context.Context, request *pb.ForcePasswordResetRequest) (*pb.ForcePasswordResetResponse, error) {
+	admin, err := a.s.authorizeAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+
+	t, u, err := a.modify(request.TenantId, request.Username, func(u *store.User) error {
+		u.ResetRequired = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := a.s.endSessions(t, u.Username); err != nil {
+		return nil, err
+	}
+	a.s.emit(ctx, t.ID, audit.AdminResetForced, u.Username, "", map[string]string{"admin": admin})
+
+	return &pb.ForcePasswordResetResponse{User: a.account(t, u)}, nil
+}
+
+// DeleteUser removes an account and ends every session of it
+func (a *AdminServer) DeleteUser(ctx context.Context, request *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	admin, err := a.s.authorizeAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	t, err := a.s.getTenant(request.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUsername(request.Username); err != nil {
+		return nil, err
+	}
+
+	err = a.s.StoreService.DeleteUser(t.ID, request.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, userError(codes.NotFound, request.Username, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not delete user")
+	}
+	if err := a.s.endSessions(t, request.Username); err != nil {
+		return nil, err
+	}
+	a.s.Limiter.Success(tenant.Key(t.ID, request.Username))
+	a.s.emit(ctx, t.ID, audit.AdminDeleted, request.Username, "", map[string]string{"admin": admin})
+
+	return &pb.DeleteUserResponse{}, nil
+}
+
+// ListSessions returns the sessions of an account that have not run out,
+// revoked ones included
+func (a *AdminServer) ListSessions(ctx context.Context, request *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	if _, err := a.s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	t, err := a.s.getTenant(request.TenantId)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUsername(request.Username); err != nil {
+		return nil, err
+	}
+
+	tokens, err := a.s.StoreService.ListRefreshTokens(t.ID, request.Username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not list sessions")
+	}
+
+	// a session has a refresh token for every time it was refreshed, only
+	// the last one is unused
+	resp := pb.ListSessionsResponse{}
+	sessions := make(map[string]*pb.AccountSession)
+	for _, rt := range tokens {
+		ps, ok := sessions[rt.SessionID]
+		if !ok {
+			ps = &pb.AccountSession{
+				SessionId: rt.SessionID,
+				IssuedAt:  rt.IssuedAt.Unix(),
+				ExpiresAt: rt.ExpiresAt.Unix(),
+			}
+			sessions[rt.SessionID] = ps
+			resp.Sessions = append(resp.Sessions, ps)
+		} else {
+			ps.Refreshes++
+		}
+		if !rt.Used {
+			ps.Active = true
+		}
+	}
+	for _, ps := range resp.Sessions {
+		if !ps.Active {
+			continue
+		}
+		revoked, err := a.s.StoreService.IsRevoked(t.ID, request.Username, ps.SessionId, time.Unix(ps.IssuedAt, 0))
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not check revocation")
+		}
+		ps.Active = !revoked
+	}
+
+	return &resp, nil
+}
+
+// modify applies fn to an account named by an admin and returns its tenant
+// and the account as it was saved
+func (a *AdminServer) modify(tenantID, username string, fn func(*store.User) error) (*store.Tenant, *store.User, error) {
+	t, err := a.s.getTenant(tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateUsername(username); err != nil {
+		return nil, nil, err
+	}
+
+	var saved *store.User
+	err = a.s.StoreService.ModifyUser(t.ID, username, func(u *store.User) error {
+		if err := fn(u); err != nil {
+			return err
+		}
+		saved = u.Clone()
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil, userError(codes.NotFound, username, "user not found")
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, "could not update user")
+	}
+
+	return t, saved, nil
+}
+
+// account turns a stored user into what an admin gets to see of it, which
+// never includes the salt, verifier or second factor secret
+func (a *AdminServer) account(t *store.Tenant, u *store.User) *pb.Account {
+	p := &pb.Account{
+		TenantId:              t.ID,
+		Username:              u.Username,
+		GroupId:               u.GroupID,
+		Kdf:                   kdfToProto(u.KDF),
+		PasswordResetRequired: u.ResetRequired,
+	}
+	if u.TOTP != nil && u.TOTP.Confirmed {
+		p.TotpEnrolled = true
+		p.RecoveryCodesLeft = int32(len(u.TOTP.RecoveryCodes))
+	}
+	if u.Lock != nil {
+		p.Locked = true
+		p.LockReason = u.Lock.Reason
+		p.LockedBy = u.Lock.By
+		p.LockedAt = u.Lock.At.Unix()
+	}
+	if locked, wait := a.s.Limiter.Locked(tenant.Key(t.ID, u.Username)); locked {
+		p.LockoutSeconds = int64(wait.Round(time.Second) / time.Second)
+	}
+
+	return p
+}
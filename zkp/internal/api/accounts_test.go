@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/client"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// adminToken is the bearer token newAdminServer accepts
+const adminToken = "admin-token"
+
+// newAdminServer serves a Server with root as its admin user, the ops
+// client certificate and adminToken, along with its Admin service
+func newAdminServer(t *testing.T) (*testServer, *AdminServer) {
+	t.Helper()
+
+	ts := newTestServer(t, func(s *Server) {
+		s.Admins = Admins{Users: []string{"root"}, ClientNames: []string{"ops"}, Token: adminToken}
+	})
+	ts.register(t, "root", "toor")
+
+	return ts, NewAdminServer(ts.Server)
+}
+
+// bearer returns a context carrying the token the way gRPC clients send it
+func bearer(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// withCert returns a context of a caller that presented a verified client
+// certificate with the given common name
+func withCert(name string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+func TestAuthorizeAdmin(t *testing.T) {
+	ts, admin := newAdminServer(t)
+	ts.register(t, "alice", "hunter2")
+	_, alice := ts.login(t, "alice", "hunter2")
+	_, root := ts.login(t, "root", "toor")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"no credentials", context.Background(), codes.Unauthenticated},
+		{"user token of a non-admin", bearer(alice.Token), codes.PermissionDenied},
+		{"wrong admin token", bearer(adminToken + "x"), codes.Unauthenticated},
+		{"unknown client certificate", withCert("intruder"), codes.Unauthenticated},
+		{"user token of an admin", bearer(root.Token), codes.OK},
+		{"admin token", bearer(adminToken), codes.OK},
+		{"known client certificate", withCert("ops"), codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := admin.GetUser(tt.ctx, &pb.GetUserRequest{Username: "alice"})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("GetUser() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	tests := []struct {
+		name string
+		act  func(a *AdminServer) error
+		// check is given the error of logging in afterwards, which runs
+		// both Login and Validate
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "LockUser",
+			act: func(a *AdminServer) error {
+				_, err := a.LockUser(bearer(adminToken), &pb.LockUserRequest{Username: "alice", Reason: "stolen laptop"})
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				if status.Code(err) != codes.PermissionDenied {
+					t.Errorf("Login() of a locked account error = %v, want %v", err, codes.PermissionDenied)
+				}
+			},
+		},
+		{
+			name: "ForcePasswordReset",
+			act: func(a *AdminServer) error {
+				_, err := a.ForcePasswordReset(bearer(adminToken), &pb.ForcePasswordResetRequest{Username: "alice"})
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, client.ErrPasswordResetRequired) {
+					t.Errorf("Login() after a forced reset error = %v, want %v", err, client.ErrPasswordResetRequired)
+				}
+			},
+		},
+		{
+			name: "DeleteUser",
+			act: func(a *AdminServer) error {
+				_, err := a.DeleteUser(bearer(adminToken), &pb.DeleteUserRequest{Username: "alice"})
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				if status.Code(err) != codes.NotFound {
+					t.Errorf("Login() of a deleted account error = %v, want %v", err, codes.NotFound)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, admin := newAdminServer(t)
+			ts.register(t, "alice", "hunter2")
+			_, before := ts.login(t, "alice", "hunter2")
+
+			if err := tt.act(admin); err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+
+			if ts.active(t, before.Token) {
+				t.Errorf("session from before %s() is still active", tt.name)
+			}
+			_, err := ts.client().Login(context.Background(), "alice", "hunter2")
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	ts, admin := newAdminServer(t)
+	ts.register(t, "alice", "hunter2")
+
+	if _, err := admin.LockUser(bearer(adminToken), &pb.LockUserRequest{Username: "alice"}); err != nil {
+		t.Fatalf("LockUser() error = %v", err)
+	}
+	if _, err := admin.UnlockUser(bearer(adminToken), &pb.UnlockUserRequest{Username: "alice"}); err != nil {
+		t.Fatalf("UnlockUser() error = %v", err)
+	}
+	ts.login(t, "alice", "hunter2")
+}
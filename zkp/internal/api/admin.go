@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Admins decides who may call admin-only RPCs
+type Admins struct {
+	// Users are usernames whose session tokens are accepted
+	Users []string
+	// ClientNames are common names or DNS names of verified client certificates
+	ClientNames []string
+	// Token is a bearer token that is accepted as it is, none when empty
+	Token string
+}
+
+// authorizeAdmin returns who the admin calling is, by client certificate,
+// admin token or else by session token
+func (s *Server) authorizeAdmin(ctx context.Context) (string, error) {
+	if cert := clientCertificate(ctx); cert != nil {
+		for _, name := range s.Admins.ClientNames {
+			if name == cert.Subject.CommonName || cert.VerifyHostname(name) == nil {
+				return "cert:" + name, nil
+			}
+		}
+	}
+
+	// without a token there is no point in telling the caller they are not an admin
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("authorization")) == 0 {
+		return "", status.Error(codes.Unauthenticated, "admin credentials required")
+	}
+	// hashed first so the comparison takes as long whatever the lengths
+	if t := bearerToken(ctx); s.Admins.Token != "" && t != "" {
+		want, got := sha256.Sum256([]byte(s.Admins.Token)), sha256.Sum256([]byte(t))
+		if subtle.ConstantTimeCompare(want[:], got[:]) == 1 {
+			return "token", nil
+		}
+	}
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return "", err
+	}
+	// admins are users of the default tenant, the others are not ours to run
+	if tenant.Normalize(claims.Tenant) != tenant.Default {
+		return "", status.Error(codes.PermissionDenied, "admins only")
+	}
+	for _, u := range s.Admins.Users {
+		if u == claims.Subject {
+			return "user:" + u, nil
+		}
+	}
+
+	return "", status.Error(codes.PermissionDenied, "admins only")
+}
+
+// clientCertificate returns the verified certificate of the caller, if any
+func clientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return info.State.VerifiedChains[0][0]
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/client"
+	hsinmemory "github.com/imthaghost/goland/zkp/internal/handshake/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/store/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/token/keyring"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	gosrp "github.com/1Password/srp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testKDF is the cheapest KDF we accept, to keep the tests quick
+var testKDF = kdf.Params{Algorithm: kdf.Argon2id, Iterations: kdf.MinArgon2Time, Memory: kdf.MinArgon2Memory, Parallelism: 1}
+
+// testServer is a Server backed by memory, served in process
+type testServer struct {
+	*Server
+	conn *grpc.ClientConn
+}
+
+// newTestServer will serve a Server set up by setup, which may be nil,
+// until the test ends
+func newTestServer(t *testing.T, setup func(s *Server)) *testServer {
+	t.Helper()
+
+	group, err := srp.GroupForBits(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := srp.New(group, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := hsinmemory.New(time.Minute)
+	t.Cleanup(hs.Close)
+	ts, err := keyring.New(nil, "", "zkp", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(inmemory.New(), ps, hs, ts)
+	s.KDFPolicy = testKDF
+	if setup != nil {
+		setup(s)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pb.RegisterAuthServer(gs, s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &testServer{Server: s, conn: conn}
+}
+
+// client returns a new client of the server with a session store of its
+// own, calls are not retried so every error shows
+func (ts *testServer) client() *client.Client {
+	return client.New(ts.conn, client.WithRetries(0, 0))
+}
+
+// register will enroll username with password, failing the test if it can not
+func (ts *testServer) register(t *testing.T, username, password string) {
+	t.Helper()
+
+	if err := ts.client().Register(context.Background(), username, password); err != nil {
+		t.Fatalf("Register(%s) error = %v", username, err)
+	}
+}
+
+// login returns a client logged in as username
+func (ts *testServer) login(t *testing.T, username, password string) (*client.Client, *client.Session) {
+	t.Helper()
+
+	c := ts.client()
+	session, err := c.Login(context.Background(), username, password)
+	if err != nil {
+		t.Fatalf("Login(%s) error = %v", username, err)
+	}
+
+	return c, session
+}
+
+// handshake opens a login for username and returns its ID along with the
+// proof that completes it, leaving it to the test what to do with them
+func (ts *testServer) handshake(t *testing.T, username, password string) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	// the srp client wants x, and so the salt, before it picks A. Ask for
+	// the salt with a handshake we leave to expire.
+	probe, err := startLogin(t, ts, username)
+	if err != nil {
+		t.Fatalf("Login(%s) error = %v", username, err)
+	}
+	salt, err := hex.DecodeString(probe.Salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := kdfFromProto(probe.Kdf).Derive(salt, username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := ts.PasswordService.Group(probe.GroupId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := gosrp.NewSRPClient(g.(*srp.Group).Group, x, nil)
+	resp, err := ts.Login(ctx, &pb.LoginRequest{
+		Username:  username,
+		PublicKey: srp.EncodeInt(c.EphemeralPublic()),
+	})
+	if err != nil {
+		t.Fatalf("Login(%s) error = %v", username, err)
+	}
+	B, err := srp.DecodeInt(resp.ServerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetOthersPublic(B); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Key(); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := c.M(salt, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.HandshakeId, hex.EncodeToString(proof)
+}
+
+// active reports whether the server still takes the session token
+func (ts *testServer) active(t *testing.T, token string) bool {
+	t.Helper()
+
+	resp, err := ts.IntrospectToken(context.Background(), &pb.IntrospectTokenRequest{Token: token})
+	if err != nil {
+		t.Fatalf("IntrospectToken() error = %v", err)
+	}
+
+	return resp.Active
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+	"github.com/imthaghost/goland/zkp/internal/token"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// errRevoked is returned for tokens whose session has been revoked
+var errRevoked = errors.New("token revoked")
+
+// authenticate returns the claims of the session token sent as
+// "authorization: Bearer <token>" metadata, password reset tokens are not
+// good for anything but changing the password
+func (s *Server) authenticate(ctx context.Context) (*token.Claims, error) {
+	claims, err := s.authenticateAny(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Scope == token.ScopePasswordReset {
+		return nil, status.Error(codes.FailedPrecondition, "password reset required")
+	}
+
+	return claims, nil
+}
+
+// authenticateAny is authenticate for RPCs that take password reset tokens too
+func (s *Server) authenticateAny(ctx context.Context) (*token.Claims, error) {
+	t := bearerToken(ctx)
+	if t == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	claims, err := s.checkToken(t)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	// a token is only good for the tenant it was issued in
+	if id := tenant.FromMetadata(ctx); id != "" && id != tenant.Normalize(claims.Tenant) {
+		return nil, status.Error(codes.PermissionDenied, "token belongs to another tenant")
+	}
+
+	return claims, nil
+}
+
+// bearerToken returns the token sent as "authorization: Bearer <token>"
+// metadata, or nothing
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var t string
+	for _, v := range md.Get("authorization") {
+		if strings.HasPrefix(strings.ToLower(v), "bearer ") {
+			t = strings.TrimSpace(v[len("bearer "):])
+		}
+	}
+
+	return t
+}
+
+// checkToken verifies a session token and makes sure it has not been revoked
+func (s *Server) checkToken(t string) (*token.Claims, error) {
+	claims, err := s.TokenService.Verify(t)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.StoreService.IsRevoked(claims.Tenant, claims.Subject, claims.SessionID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errRevoked
+	}
+
+	return claims, nil
+}
+
+// issueSession mints a session token and a refresh token for an SRP session
+// of a user of the tenant that started at issuedAt and can be refreshed
+// until expiresAt
+func (s *Server) issueSession(tn *store.Tenant, username, sessionID string, issuedAt, expiresAt time.Time) (string, *token.Claims, string, error) {
+	t, claims, err := s.TokenService.Issue(tn.ID, username, sessionID, "", tn.Policy.TokenTTL)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	refresh, hash, err := token.NewRefreshToken()
+	if err != nil {
+		return "", nil, "", err
+	}
+	err = s.StoreService.CreateRefreshToken(&store.RefreshToken{
+		Hash:      hash,
+		Tenant:    tn.ID,
+		Username:  username,
+		SessionID: sessionID,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	return t, claims, refresh, nil
+}
+
+// issueResetToken mints a token that is only good for changing the password
+// of a user whose reset an admin forced. There is no refresh token, the
+// session only starts once the password is changed.
+func (s *Server) issueResetToken(tn *store.Tenant, username, sessionID string) (string, *token.Claims, error) {
+	return s.TokenService.Issue(tn.ID, username, sessionID, token.ScopePasswordReset, tn.Policy.TokenTTL)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+)
+
+// decoySaltLength matches the salts our clients generate
+const decoySaltLength = 16
+
+// DefaultDecoyFloor is how long Login takes at least once decoys are
+// enabled, well above what reading and opening a stored user costs
+const DefaultDecoyFloor = 50 * time.Millisecond
+
+// decoy answers Login for usernames that do not exist, so that they look
+// exactly like ones that do. The salt is derived from the username with a
+// server secret so it stays the same across attempts and restarts, and the
+// verifier is a real one nobody knows the password for, so the handshake
+// does the same work and Validate simply fails. Tenants may make verifiers
+// for different groups, so there is one for every group. Made up users skip
+// reading and opening a stored one, so Login is held to a floor either way.
+type decoy struct {
+	secret    []byte
+	verifiers map[string]string
+	floor     time.Duration
+}
+
+// newDecoy will set up decoys for the given secret
+func newDecoy(secret []byte, ps password.Service, floor time.Duration) (*decoy, error) {
+	d := &decoy{
+		secret:    secret,
+		verifiers: make(map[string]string),
+		floor:     floor,
+	}
+	for _, g := range append(ps.Groups(), ps.DefaultGroup()) {
+		x := make([]byte, 32)
+		if _, err := rand.Read(x); err != nil {
+			return nil, err
+		}
+		v, err := g.Verifier(new(big.Int).SetBytes(x))
+		if err != nil {
+			return nil, err
+		}
+		d.verifiers[g.ID()] = srp.EncodeInt(v)
+	}
+
+	return d, nil
+}
+
+// user will make up a user of the tenant for a username that does not
+// exist, enrolled in the group with the KDF policy like any recent user
+func (d *decoy) user(tenantID, username string, g password.Group, policy kdf.Params) *store.User {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte("salt\x00"))
+	mac.Write([]byte(tenant.Key(tenantID, username)))
+
+	return &store.User{
+		Tenant:   tenantID,
+		Username: username,
+		Salt:     hex.EncodeToString(mac.Sum(nil)[:decoySaltLength]),
+		GroupID:  g.ID(),
+		Verifier: d.verifiers[g.ID()],
+		KDF:      policy,
+	}
+}
+
+// wait will return once the floor has passed since start, or the caller
+// gave up, so stored and made up users are answered just as quickly
+func (d *decoy) wait(ctx context.Context, start time.Time) {
+	if d == nil {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(start.Add(d.floor)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
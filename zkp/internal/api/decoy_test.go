@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/store"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// startLogin sends Login with a made up A
+func startLogin(t *testing.T, ts *testServer, username string) (*pb.LoginResponse, error) {
+	t.Helper()
+
+	g := ts.PasswordService.DefaultGroup()
+	A := new(big.Int).Exp(g.Generator(), big.NewInt(12345), g.Prime())
+
+	return ts.Login(context.Background(), &pb.LoginRequest{
+		Username:  username,
+		PublicKey: srp.EncodeInt(A),
+	})
+}
+
+// withDecoys enables decoys with the given secret
+func withDecoys(t *testing.T, secret string) func(s *Server) {
+	return func(s *Server) {
+		if err := s.EnableDecoys([]byte(secret)); err != nil {
+			t.Fatalf("EnableDecoys() error = %v", err)
+		}
+	}
+}
+
+func TestLoginUnknownUser(t *testing.T) {
+	plain := newTestServer(t, nil)
+	if _, err := startLogin(t, plain, "nobody"); status.Code(err) != codes.NotFound {
+		t.Errorf("Login() without decoys error = %v, want %v", err, codes.NotFound)
+	}
+
+	ts := newTestServer(t, withDecoys(t, "secret"))
+	ts.register(t, "alice", "hunter2")
+
+	enrolled, err := startLogin(t, ts, "alice")
+	if err != nil {
+		t.Fatalf("Login(alice) error = %v", err)
+	}
+	decoy, err := startLogin(t, ts, "nobody")
+	if err != nil {
+		t.Fatalf("Login(nobody) error = %v", err)
+	}
+
+	// nothing in the reply sets the made up user apart
+	if len(decoy.Salt) != len(enrolled.Salt) {
+		t.Errorf("decoy salt is %d characters, a real one %d", len(decoy.Salt), len(enrolled.Salt))
+	}
+	if decoy.GroupId != enrolled.GroupId {
+		t.Errorf("decoy group = %s, want %s", decoy.GroupId, enrolled.GroupId)
+	}
+	if !proto.Equal(decoy.Kdf, enrolled.Kdf) {
+		t.Errorf("decoy kdf = %v, want %v", decoy.Kdf, enrolled.Kdf)
+	}
+	if decoy.HandshakeId == "" || decoy.ServerPublicKey == "" {
+		t.Errorf("decoy reply = %v, want a handshake", decoy)
+	}
+}
+
+func TestDecoySalt(t *testing.T) {
+	ts := newTestServer(t, withDecoys(t, "secret"))
+	restarted := newTestServer(t, withDecoys(t, "secret"))
+	other := newTestServer(t, withDecoys(t, "another secret"))
+
+	salt := func(ts *testServer, username string) string {
+		t.Helper()
+		resp, err := startLogin(t, ts, username)
+		if err != nil {
+			t.Fatalf("Login(%s) error = %v", username, err)
+		}
+		return resp.Salt
+	}
+	want := salt(ts, "nobody")
+
+	tests := []struct {
+		name     string
+		server   *testServer
+		username string
+		same     bool
+	}{
+		// a salt that changed between attempts would give the user away
+		{"asked again", ts, "nobody", true},
+		{"after a restart", restarted, "nobody", true},
+		{"another username", ts, "somebody", false},
+		{"another secret", other, "nobody", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := salt(tt.server, tt.username); (got == want) != tt.same {
+				t.Errorf("salt = %s, first salt %s, want same %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+func TestDecoyFailsLikeWrongPassword(t *testing.T) {
+	ts := newTestServer(t, withDecoys(t, "secret"))
+	ts.register(t, "alice", "hunter2")
+
+	_, wrongPassword := ts.client().Login(context.Background(), "alice", "hunter3")
+	_, unknownUser := ts.client().Login(context.Background(), "nobody", "hunter2")
+
+	want := status.Convert(wrongPassword)
+	if want.Code() != codes.Unauthenticated {
+		t.Fatalf("Login() with a wrong password error = %v, want %v", wrongPassword, codes.Unauthenticated)
+	}
+	got := status.Convert(unknownUser)
+	if got.Code() != want.Code() || got.Message() != want.Message() {
+		t.Errorf("Login() of an unknown user error = %v, want %v", unknownUser, wrongPassword)
+	}
+}
+
+// slowStore takes a while to hand out a stored user, like one that has to
+// be read from disk and opened
+type slowStore struct {
+	store.Service
+	delay time.Duration
+}
+
+func (s slowStore) GetUserByUsername(tenantID, username string) (*store.User, error) {
+	u, err := s.Service.GetUserByUsername(tenantID, username)
+	if err == nil {
+		time.Sleep(s.delay)
+	}
+	return u, err
+}
+
+func TestDecoyTiming(t *testing.T) {
+	const floor = 200 * time.Millisecond
+	ts := newTestServer(t, func(s *Server) {
+		s.StoreService = slowStore{Service: s.StoreService, delay: 20 * time.Millisecond}
+		s.DecoyFloor = floor
+		withDecoys(t, "secret")(s)
+	})
+	ts.register(t, "alice", "hunter2")
+
+	took := func(username string) time.Duration {
+		t.Helper()
+		start := time.Now()
+		if _, err := startLogin(t, ts, username); err != nil {
+			t.Fatalf("Login(%s) error = %v", username, err)
+		}
+		return time.Since(start)
+	}
+
+	// skipping the store read must not make the made up user quicker
+	for _, username := range []string{"alice", "nobody"} {
+		if d := took(username); d < floor {
+			t.Errorf("Login(%s) took %v, want at least %v", username, d, floor)
+		}
+	}
+}
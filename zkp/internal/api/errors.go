@@ -0,0 +1,66 @@
+package api
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxUsernameLength is the longest username, in bytes, we accept
+const maxUsernameLength = 64
+
+// invalidArgument returns an InvalidArgument status describing which field was wrong
+func invalidArgument(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	ds, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{
+				Field:       field,
+				Description: description,
+			},
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return ds.Err()
+}
+
+// userError returns a status with code c about the user with the given username
+func userError(c codes.Code, username, description string) error {
+	st := status.New(c, description)
+	ds, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "user",
+		ResourceName: username,
+		Description:  description,
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return ds.Err()
+}
+
+// validateUsername makes sure a username is something we are happy to store and log
+func validateUsername(username string) error {
+	if username == "" {
+		return invalidArgument("username", "username is required")
+	}
+	if len(username) > maxUsernameLength {
+		return invalidArgument("username", "username is too long")
+	}
+	if !utf8.ValidString(username) {
+		return invalidArgument("username", "username must be valid utf-8")
+	}
+	for _, r := range username {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return invalidArgument("username", "username cannot contain whitespace or control characters")
+		}
+	}
+
+	return nil
+}
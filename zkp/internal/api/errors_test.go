@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestErrorDetails(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Limiter = ratelimit.New(ratelimit.Config{LockoutThreshold: 1, LockoutBase: time.Minute})
+	})
+	ts.register(t, "alice", "hunter2")
+	ctx := context.Background()
+
+	// Login the way the server runs it, behind the rate limiter
+	limited := func(request *pb.LoginRequest) error {
+		ctx := peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+		intercept := ratelimit.UnaryServerInterceptor(ts.Limiter)
+		_, err := intercept(ctx, request, &grpc.UnaryServerInfo{FullMethod: "/auth.Auth/Login"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return ts.Login(ctx, req.(*pb.LoginRequest))
+		})
+		return err
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+		want proto.Message
+	}{
+		{
+			name: "bad username",
+			call: func() error {
+				_, err := ts.Register(ctx, &pb.RegisterRequest{Username: "al ice"})
+				return err
+			},
+			code: codes.InvalidArgument,
+			want: &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "username",
+				Description: "username cannot contain whitespace or control characters",
+			}}},
+		},
+		{
+			name: "malformed public key",
+			call: func() error {
+				_, err := ts.Login(ctx, &pb.LoginRequest{Username: "alice", PublicKey: "not hex"})
+				return err
+			},
+			code: codes.InvalidArgument,
+			want: &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "public_key",
+				Description: "malformed public key",
+			}}},
+		},
+		{
+			name: "user taken",
+			call: func() error {
+				_, err := ts.Register(ctx, enrollment(t, "alice", ts.PasswordService.DefaultGroup()))
+				return err
+			},
+			code: codes.AlreadyExists,
+			want: &errdetails.ResourceInfo{ResourceType: "user", ResourceName: "alice", Description: "user already exists"},
+		},
+		{
+			name: "unknown user",
+			call: func() error {
+				_, err := startLogin(t, ts, "nobody")
+				return err
+			},
+			code: codes.NotFound,
+			want: &errdetails.ResourceInfo{ResourceType: "user", ResourceName: "nobody", Description: "could not find user"},
+		},
+		{
+			name: "locked account",
+			call: func() error {
+				ts.Limiter.Failure(tenant.Key("", "alice"))
+				return limited(&pb.LoginRequest{Username: "alice"})
+			},
+			code: codes.ResourceExhausted,
+			want: &errdetails.RetryInfo{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(tt.call())
+			if st.Code() != tt.code {
+				t.Fatalf("code = %v, want %v", st.Code(), tt.code)
+			}
+			if len(st.Details()) != 1 {
+				t.Fatalf("details = %v, want one %T", st.Details(), tt.want)
+			}
+			got, ok := st.Details()[0].(proto.Message)
+			if !ok {
+				t.Fatalf("detail %v is not a message", st.Details()[0])
+			}
+
+			// how long to wait is up to the limiter, that there is a wait is not
+			if ri, ok := got.(*errdetails.RetryInfo); ok {
+				if ri.RetryDelay.AsDuration() <= 0 {
+					t.Errorf("RetryInfo delay = %v, want more than 0", ri.RetryDelay.AsDuration())
+				}
+				ri.RetryDelay = nil
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("detail = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
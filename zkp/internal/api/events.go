@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// watchBuffer is how many events a WatchEvents stream may fall behind
+const watchBuffer = 256
+
+// WatchEvents streams audit events to an admin until they hang up
+func (s *Server) WatchEvents(request *pb.WatchEventsRequest, stream pb.Auth_WatchEventsServer) error {
+	if _, err := s.authorizeAdmin(stream.Context()); err != nil {
+		return err
+	}
+	if s.EventFeed == nil {
+		return status.Error(codes.Unavailable, "audit events are not enabled")
+	}
+
+	types := make(map[string]bool, len(request.GetTypes()))
+	for _, t := range request.GetTypes() {
+		types[t] = true
+	}
+
+	events, stop := s.EventFeed.Subscribe(watchBuffer)
+	defer stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "event stream ended, watch again")
+			}
+			if len(types) > 0 && !types[e.Type] {
+				continue
+			}
+			if request.GetUsername() != "" && request.GetUsername() != e.Username {
+				continue
+			}
+
+			if request.GetTenantId() != "" && request.GetTenantId() != e.Tenant {
+				continue
+			}
+
+			err := stream.Send(&pb.AuditEvent{
+				TimeUnixNano: e.Time.UnixNano(),
+				Type:         e.Type,
+				TenantId:     e.Tenant,
+				Username:     e.Username,
+				SessionId:    e.SessionID,
+				Peer:         e.Peer,
+				Detail:       e.Detail,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// emit will send an audit event about the caller, a user of the tenant, if
+// auditing is enabled
+func (s *Server) emit(ctx context.Context, tenantID, typ, username, sessionID string, detail map[string]string) {
+	if s.AuditService == nil {
+		return
+	}
+
+	s.AuditService.Emit(audit.Event{
+		Type:      typ,
+		Tenant:    tenant.Normalize(tenantID),
+		Username:  username,
+		SessionID: sessionID,
+		Peer:      peerHost(ctx),
+		Detail:    detail,
+	})
+}
+
+// failedProof will count a bad proof against the user of the tenant and
+// record it, along with the lockout it may have caused
+func (s *Server) failedProof(ctx context.Context, t *store.Tenant, username, sessionID, during string) {
+	s.failed(ctx, t, username, sessionID, "bad proof", during)
+}
+
+// failed will count a failed login step against the user of the tenant and
+// record it, along with the lockout it may have caused
+func (s *Server) failed(ctx context.Context, t *store.Tenant, username, sessionID, reason, during string) {
+	locked := s.Limiter.FailureThreshold(tenant.Key(t.ID, username), t.Policy.LockoutThreshold)
+	s.emit(ctx, t.ID, audit.LoginFailed, username, sessionID, map[string]string{
+		"reason": reason,
+		"during": during,
+	})
+	if locked > 0 {
+		s.emit(ctx, t.ID, audit.AccountLocked, username, sessionID, map[string]string{
+			"for": locked.String(),
+		})
+	}
+}
+
+// peerHost returns the host of the caller without its port
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
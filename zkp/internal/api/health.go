@@ -2,14 +2,28 @@ package api
 
 import (
 	"context"
+
 	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
+// HealthCheck is kept for old clients, new ones should use grpc.health.v1.Health
 func (s *Server) HealthCheck(ctx context.Context, request *pb.HealthRequest) (*pb.HealthResponse, error) {
+	if s.HealthService == nil {
+		return &pb.HealthResponse{}, nil
+	}
 
-	resp := pb.HealthResponse{
-		Status: int64(200),
+	resp, err := s.HealthService.Check(ctx, &healthpb.HealthCheckRequest{Service: ServiceName})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return nil, status.Error(codes.Unavailable, "not serving")
 	}
 
-	return &resp, nil
+	// a response without an error means we are serving
+	return &pb.HealthResponse{}, nil
 }
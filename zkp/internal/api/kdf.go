@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// kdfFromProto will convert KDF parameters from the wire, none means rfc5054
+func kdfFromProto(k *pb.KDFParameters) kdf.Params {
+	if k == nil {
+		return kdf.Params{Algorithm: kdf.RFC5054}
+	}
+
+	return kdf.Params{
+		Algorithm:   k.Algorithm,
+		Iterations:  k.Iterations,
+		Memory:      k.Memory,
+		Parallelism: k.Parallelism,
+	}
+}
+
+// kdfToProto will convert KDF parameters for the wire
+func kdfToProto(p kdf.Params) *pb.KDFParameters {
+	p = p.Normalize()
+
+	return &pb.KDFParameters{
+		Algorithm:   p.Algorithm,
+		Iterations:  p.Iterations,
+		Memory:      p.Memory,
+		Parallelism: p.Parallelism,
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// PublicKeys returns the keys tokens are signed with so other services can verify them offline
+func (s *Server) PublicKeys(ctx context.Context, request *pb.PublicKeysRequest) (*pb.PublicKeysResponse, error) {
+	resp := pb.PublicKeysResponse{}
+	for _, k := range s.TokenService.PublicKeys() {
+		resp.Keys = append(resp.Keys, &pb.PublicKey{
+			KeyId:     k.ID,
+			Algorithm: "EdDSA",
+			Key:       base64.RawURLEncoding.EncodeToString(k.Key),
+		})
+	}
+
+	return &resp, nil
+}
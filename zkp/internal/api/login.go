@@ -1 +1,112 @@
 package api
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/store"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Login(ctx context.Context, request *pb.LoginRequest) (*pb.LoginResponse, error) {
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	if err := validateUsername(request.Username); err != nil {
+		return nil, err
+	}
+
+	t, err := s.tenant(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	A, err := srp.DecodeInt(request.PublicKey)
+	if err != nil {
+		return nil, invalidArgument("public_key", "malformed public key")
+	}
+
+	// from here on an unknown user takes less work than a stored one
+	defer s.decoy.wait(ctx, time.Now())
+
+	policy, _ := s.kdfPolicy(t)
+	unknown := false
+	u, err := s.StoreService.GetUserByUsername(t.ID, request.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		s.emit(ctx, t.ID, audit.LoginFailed, request.Username, "", map[string]string{"reason": "unknown user"})
+		if s.decoy == nil {
+			return nil, userError(codes.NotFound, request.Username, "could not find user")
+		}
+		// carry on with a made up user, Validate will fail like a wrong password
+		u, err = s.decoy.user(t.ID, request.Username, s.defaultGroup(t), policy), nil
+		unknown = true
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve user")
+	}
+
+	salt, err := hex.DecodeString(u.Salt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "stored salt is malformed")
+	}
+	v, err := srp.DecodeInt(u.Verifier)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "stored verifier is malformed")
+	}
+
+	// users from before group IDs were checked may have anything stored
+	g, err := s.PasswordService.Group(u.GroupID)
+	if errors.Is(err, password.ErrUnknownGroup) {
+		g, err = s.PasswordService.Group(srp.LegacyGroupID)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "stored group is not supported")
+	}
+
+	server, err := g.NewSession(u.Username, salt, v, A)
+	if errors.Is(err, password.ErrBadPublic) {
+		return nil, invalidArgument("public_key", "invalid public key")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not start handshake")
+	}
+
+	// keep the server side around until the client proves itself
+	id, err := s.HandshakeService.Create(&handshake.Session{
+		Tenant:   t.ID,
+		Username: u.Username,
+		Salt:     u.Salt,
+		Server:   server,
+		Upgrade:  u.KDF.Weaker(policy),
+		// decoys have no second factor, which can not give them away as
+		// the code is only asked for after a good proof
+		SecondFactor:  u.TOTP != nil && u.TOTP.Confirmed,
+		Locked:        u.Lock != nil,
+		ResetRequired: u.ResetRequired,
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not start handshake")
+	}
+	if !unknown {
+		s.emit(ctx, t.ID, audit.LoginStarted, u.Username, id, nil)
+	}
+
+	resp := pb.LoginResponse{
+		Salt:            u.Salt,
+		GroupId:         g.ID(),
+		ServerPublicKey: srp.EncodeInt(server.EphemeralPublic()),
+		HandshakeId:     id,
+		Kdf:             kdfToProto(u.KDF),
+	}
+	return &resp, nil
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+)
+
+// GetParameters publishes the groups new verifiers of the tenant may be made for
+func (s *Server) GetParameters(ctx context.Context, request *pb.GetParametersRequest) (*pb.GetParametersResponse, error) {
+	t, err := s.tenant(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, _ := s.kdfPolicy(t)
+	resp := pb.GetParametersResponse{
+		DefaultGroupId: s.defaultGroup(t).ID(),
+		MinBits:        int32(s.PasswordService.MinBits()),
+		Hash:           "SHA-256",
+		Kdf:            kdfToProto(policy),
+	}
+	for _, g := range s.groups(t) {
+		resp.Groups = append(resp.Groups, &pb.SRPGroup{
+			Id:        g.ID(),
+			Bits:      int32(g.Bits()),
+			Prime:     srp.EncodeInt(g.Prime()),
+			Generator: srp.EncodeInt(g.Generator()),
+		})
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	gosrp "github.com/1Password/srp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGroupID(t *testing.T) {
+	ts := newTestServer(t, nil)
+	g2048 := &srp.Group{Group: gosrp.KnownGroups[srp.RFC5054Group2048]}
+	g4096 := &srp.Group{Group: gosrp.KnownGroups[srp.RFC5054Group4096]}
+
+	// acme only takes 4096 bit verifiers
+	if err := ts.StoreService.CreateTenant(&store.Tenant{ID: "acme", Policy: store.Policy{Groups: []string{g4096.ID()}}}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		edit   func(r *pb.RegisterRequest)
+		ok     bool
+	}{
+		{"supported group", "", func(r *pb.RegisterRequest) {}, true},
+		{"unknown group", "", func(r *pb.RegisterRequest) { r.GroupId = "something" }, false},
+		{"no group", "", func(r *pb.RegisterRequest) { r.GroupId = "" }, false},
+		{"group the tenant allows", "acme", func(r *pb.RegisterRequest) { *r = *enrollment(t, r.Username, g4096) }, true},
+		{"group the tenant does not allow", "acme", func(r *pb.RegisterRequest) {}, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := enrollment(t, fmt.Sprintf("user%d", i), g2048)
+			tt.edit(r)
+			r.TenantId = tt.tenant
+
+			_, err := ts.Register(context.Background(), r)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("Register() error = %v", err)
+				}
+				return
+			}
+			if status.Code(err) != codes.InvalidArgument || violation(err) != "group_id" {
+				t.Errorf("Register() error = %v with a violation of %q, want %v of group_id", err, violation(err), codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestGetParameters(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if err := ts.StoreService.CreateTenant(&store.Tenant{ID: "acme", Policy: store.Policy{Groups: []string{"something", srp.LegacyGroupID}}}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	tests := []struct {
+		tenant string
+		want   []string
+	}{
+		{tenant.Default, []string{"5054A2048", "5054A3072", "5054A4096"}},
+		// groups the server no longer supports are left out
+		{"acme", []string{srp.LegacyGroupID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			resp, err := ts.GetParameters(context.Background(), &pb.GetParametersRequest{TenantId: tt.tenant})
+			if err != nil {
+				t.Fatalf("GetParameters() error = %v", err)
+			}
+			var got []string
+			for _, g := range resp.Groups {
+				got = append(got, g.Id)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("groups = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("groups = %v, want %v", got, tt.want)
+				}
+			}
+			if resp.DefaultGroupId != tt.want[0] {
+				t.Errorf("default group = %s, want %s", resp.DefaultGroupId, tt.want[0])
+			}
+		})
+	}
+}
@@ -2,35 +2,100 @@ package api
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
 	"github.com/imthaghost/goland/zkp/internal/store"
-	"net/http"
 
 	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// minSaltLength is the smallest salt, in bytes, we accept from a client
+const minSaltLength = 8
+
 func (s *Server) Register(ctx context.Context, request *pb.RegisterRequest) (*pb.RegisterResponse, error) {
 	// try to create a user from the request
 	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+	if err := validateUsername(request.Username); err != nil {
+		return nil, err
+	}
+	t, err := s.tenant(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.checkEnrollment(t, request.Salt, request.GroupId, request.Verifier, request.Kdf)
+	if err != nil {
+		return nil, err
+	}
+	u.Tenant = t.ID
+	u.Username = request.Username
 
-		return &pb.RegisterResponse{
-			Status: http.StatusBadRequest,
-		}, errors.New("cannot have empty request")
+	err = s.StoreService.CreateUser(u)
+	if errors.Is(err, store.ErrUserExists) {
+		return nil, userError(codes.AlreadyExists, u.Username, "user already exists")
 	}
-	u := &store.User{
-		Username: request.Username,
-		Salt:     request.Salt,
-		GroupID:  request.GroupId,
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not create user")
 	}
-	err := s.StoreService.CreateUser(u)
+	s.emit(ctx, t.ID, audit.Registered, u.Username, "", map[string]string{
+		"group_id": u.GroupID,
+		"kdf":      u.KDF.Algorithm,
+	})
+
+	return &pb.RegisterResponse{}, nil
+}
+
+// checkEnrollment validates the salt, group, verifier and KDF a client wants
+// to store against the policy of the tenant and returns them as a user
+// without a username
+func (s *Server) checkEnrollment(t *store.Tenant, salt, groupID, verifier string, k *pb.KDFParameters) (*store.User, error) {
+	if b, err := hex.DecodeString(salt); err != nil || len(b) < minSaltLength {
+		return nil, invalidArgument("salt", "salt must be at least 8 hex encoded bytes")
+	}
+
+	g, err := s.PasswordService.Group(groupID)
 	if err != nil {
-		return &pb.RegisterResponse{
-			Status: http.StatusInternalServerError,
-		}, errors.New("could not create user")
+		return nil, invalidArgument("group_id", "unsupported group, see GetParameters")
+	}
+	if g.Bits() < s.PasswordService.MinBits() {
+		return nil, invalidArgument("group_id", fmt.Sprintf("group must be at least %d bits", s.PasswordService.MinBits()))
+	}
+	if !allowed(s.groups(t), g) {
+		return nil, invalidArgument("group_id", "group is not allowed for this tenant, see GetParameters")
 	}
 
-	resp := pb.RegisterResponse{
-		Status: http.StatusAccepted,
+	// the verifier is the only thing standing between an attacker and the
+	// account, so make sure it is actually a member of the group
+	v, err := srp.DecodeInt(verifier)
+	if err != nil {
+		return nil, invalidArgument("verifier", "malformed verifier")
 	}
-	return &resp, nil
+	if err := g.ValidateVerifier(v); err != nil {
+		return nil, invalidArgument("verifier", err.Error())
+	}
+
+	// a weaker KDF than the policy is allowed, the user is asked to enroll
+	// again on the next login, unless the tenant sets a minimum
+	params := kdfFromProto(k)
+	if err := params.Validate(); err != nil {
+		return nil, invalidArgument("kdf", err.Error())
+	}
+	if min, strict := s.kdfPolicy(t); strict && params.Weaker(min) {
+		return nil, invalidArgument("kdf", "kdf is weaker than this tenant allows, see GetParameters")
+	}
+
+	return &store.User{
+		Salt:     salt,
+		GroupID:  g.ID(),
+		Verifier: srp.EncodeInt(v),
+		KDF:      params,
+	}, nil
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/password/srp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	gosrp "github.com/1Password/srp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// enrollment returns a RegisterRequest for username that the server takes,
+// with a verifier for the group
+func enrollment(t *testing.T, username string, g password.Group) *pb.RegisterRequest {
+	t.Helper()
+
+	v, err := g.Verifier(big.NewInt(12345))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &pb.RegisterRequest{
+		Username: username,
+		Salt:     "0011223344556677",
+		GroupId:  g.ID(),
+		Verifier: srp.EncodeInt(v),
+		Kdf:      kdfToProto(testKDF),
+	}
+}
+
+// violation returns the field of the first BadRequest field violation of err
+func violation(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok && len(br.FieldViolations) > 0 {
+			return br.FieldViolations[0].Field
+		}
+	}
+
+	return ""
+}
+
+func TestRegister(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		// 2048 bit groups are still served for old users, but not enrolled in
+		group, err := srp.GroupForBits(3072)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps, err := srp.New(group, 3072)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.PasswordService = ps
+	})
+	g := ts.PasswordService.DefaultGroup()
+	small := &srp.Group{Group: gosrp.KnownGroups[srp.RFC5054Group2048]}
+
+	tests := []struct {
+		name  string
+		edit  func(r *pb.RegisterRequest)
+		field string // of the violation, none when the user is registered
+	}{
+		{"valid", func(r *pb.RegisterRequest) {}, ""},
+		{"malformed verifier", func(r *pb.RegisterRequest) { r.Verifier = "not hex" }, "verifier"},
+		{"no verifier", func(r *pb.RegisterRequest) { r.Verifier = "" }, "verifier"},
+		{"zero verifier", func(r *pb.RegisterRequest) { r.Verifier = "00" }, "verifier"},
+		{"verifier of one", func(r *pb.RegisterRequest) { r.Verifier = "01" }, "verifier"},
+		{"verifier of N", func(r *pb.RegisterRequest) { r.Verifier = srp.EncodeInt(g.Prime()) }, "verifier"},
+		{"group below the minimum", func(r *pb.RegisterRequest) { *r = *enrollment(t, r.Username, small) }, "group_id"},
+		{"short salt", func(r *pb.RegisterRequest) { r.Salt = "0011" }, "salt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := enrollment(t, "alice-"+tt.field, g)
+			tt.edit(r)
+
+			_, err := ts.Register(context.Background(), r)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Register() error = %v", err)
+				}
+				u, err := ts.StoreService.GetUserByUsername("", r.Username)
+				if err != nil {
+					t.Fatalf("GetUserByUsername() error = %v", err)
+				}
+				if u.Verifier != r.Verifier || u.GroupID != g.ID() {
+					t.Errorf("stored verifier %s in %s, want %s in %s", u.Verifier, u.GroupID, r.Verifier, g.ID())
+				}
+				return
+			}
+			if status.Code(err) != codes.InvalidArgument || violation(err) != tt.field {
+				t.Errorf("Register() error = %v with a violation of %q, want %v of %q", err, violation(err), codes.InvalidArgument, tt.field)
+			}
+			if _, err := ts.StoreService.GetUserByUsername("", r.Username); err == nil {
+				t.Error("refused user was stored")
+			}
+		})
+	}
+}
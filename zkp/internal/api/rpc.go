@@ -1,19 +1,91 @@
 package api
 
 import (
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/channel"
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
 	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/token"
 	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// ServiceName is the name the Auth service is registered under, which is
+// also its name for health checks
+const ServiceName = "auth.Auth"
+
+// AdminServiceName is the name the Admin service is registered under
+const AdminServiceName = "auth.Admin"
+
 type Server struct {
-	StoreService store.Service
+	StoreService     store.Service
+	PasswordService  password.Service
+	HandshakeService handshake.Service
+	TokenService     token.Service
+	// ChallengeService keeps logins waiting for a second factor, without it
+	// TOTP can not be enrolled
+	ChallengeService handshake.Service
+	// KeyService holds the SRP session keys of live sessions, without it or
+	// SecureHandler SecureExchange is not available
+	KeyService channel.KeyService
+	// SecureHandler serves SecureExchange streams
+	SecureHandler channel.Handler
+
+	// RefreshTTL is how long a session can be kept alive by refreshing
+	RefreshTTL time.Duration
+	// KDFPolicy is the KDF new verifiers should be made with, users on a
+	// weaker one are asked to enroll again when they log in
+	KDFPolicy kdf.Params
+	// TOTPIssuer names us in authenticator apps
+	TOTPIssuer string
+	// Limiter is told about every proof we check so it can lock accounts, it may be nil
+	Limiter *ratelimit.Limiter
+	// AuditService receives an event for everything security relevant, it may be nil
+	AuditService audit.Service
+	// EventFeed backs WatchEvents, it may be nil
+	EventFeed audit.Feed
+	// Admins may call admin-only RPCs
+	Admins Admins
+	// HealthService backs the legacy HealthCheck, without it we always report serving
+	HealthService healthpb.HealthServer
+	// DecoyFloor is how long Login takes at least once decoys are enabled
+	DecoyFloor time.Duration
+
+	decoy *decoy
 
 	pb.UnimplementedAuthServer
 }
 
 // New ...
-func New(ss store.Service) *Server {
+func New(ss store.Service, ps password.Service, hs handshake.Service, ts token.Service) *Server {
 	return &Server{
-		StoreService: ss,
+		StoreService:     ss,
+		PasswordService:  ps,
+		HandshakeService: hs,
+		TokenService:     ts,
+		RefreshTTL:       token.DefaultRefreshTTL,
+		KDFPolicy:        kdf.DefaultPolicy,
+		TOTPIssuer:       "zkp",
+		DecoyFloor:       DefaultDecoyFloor,
 	}
 }
+
+// EnableDecoys makes Login answer for usernames that do not exist as if they
+// did, so it can not be used to find out which accounts exist. The secret
+// must be kept across restarts or the made up salts will change. Set
+// DecoyFloor before, Login is held to it from then on.
+func (s *Server) EnableDecoys(secret []byte) error {
+	d, err := newDecoy(secret, s.PasswordService, s.DecoyFloor)
+	if err != nil {
+		return err
+	}
+	s.decoy = d
+
+	return nil
+}
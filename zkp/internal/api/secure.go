@@ -0,0 +1,176 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/channel"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SecureExchange hands the messages of the bearer token's session, sealed
+// with keys derived from its SRP session key, to the SecureHandler
+func (s *Server) SecureExchange(stream pb.Auth_SecureExchangeServer) error {
+	if s.KeyService == nil || s.SecureHandler == nil {
+		return status.Error(codes.Unimplemented, "secure exchange is not available")
+	}
+	ctx := stream.Context()
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.KeyService.Get(claims.SessionID)
+	if errors.Is(err, channel.ErrNotFound) {
+		return status.Error(codes.FailedPrecondition, "no session key for this session, log in again")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "could not retrieve session key")
+	}
+
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(first.Random) != channel.RandomLength || len(first.Ciphertext) > 0 {
+		return invalidArgument("random", "the first frame must carry only 32 random bytes")
+	}
+
+	random := make([]byte, channel.RandomLength)
+	if _, err := rand.Read(random); err != nil {
+		return status.Error(codes.Internal, "could not start secure exchange")
+	}
+	fromClient, toClient, err := channel.Derive(key, first.Random, random)
+	if err != nil {
+		return status.Error(codes.Internal, "could not derive keys")
+	}
+	if err := stream.Send(&pb.SecureFrame{Random: random}); err != nil {
+		return err
+	}
+
+	err = s.SecureHandler.ServeSecure(ctx, channel.Peer{
+		Tenant:    tenant.Normalize(claims.Tenant),
+		Username:  claims.Subject,
+		SessionID: claims.SessionID,
+	}, &secureConn{
+		stream: stream,
+		open:   fromClient,
+		seal:   toClient,
+	})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, channel.ErrReplay), errors.Is(err, channel.ErrBadMessage):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, channel.ErrExhausted):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(codes.Internal, "secure exchange failed")
+}
+
+// keepKey will hold on to the key of a proven handshake so its session can
+// use SecureExchange until it ends
+func (s *Server) keepKey(sessionID string, server password.Session, until time.Time) error {
+	if s.KeyService == nil {
+		return nil
+	}
+
+	key, err := server.Key()
+	if err != nil {
+		return err
+	}
+
+	return s.KeyService.Put(sessionID, key, until)
+}
+
+// moveKey will hand the key of a session on to the session replacing it
+func (s *Server) moveKey(from, to string, until time.Time) error {
+	if s.KeyService == nil {
+		return nil
+	}
+
+	key, err := s.KeyService.Get(from)
+	if errors.Is(err, channel.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.KeyService.Put(to, key, until); err != nil {
+		return err
+	}
+
+	return s.KeyService.Delete(from)
+}
+
+// extendKey will keep the key of a session until the given time instead
+func (s *Server) extendKey(sessionID string, until time.Time) error {
+	if s.KeyService == nil {
+		return nil
+	}
+
+	key, err := s.KeyService.Get(sessionID)
+	if errors.Is(err, channel.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.KeyService.Put(sessionID, key, until)
+}
+
+// forgetKey will drop the key of a session that has ended
+func (s *Server) forgetKey(sessionID string) error {
+	if s.KeyService == nil {
+		return nil
+	}
+
+	return s.KeyService.Delete(sessionID)
+}
+
+// secureConn opens and seals the frames of a SecureExchange stream. Send and
+// Recv may be called from different goroutines, but neither from two.
+type secureConn struct {
+	stream pb.Auth_SecureExchangeServer
+	open   *channel.Cipher
+	seal   *channel.Cipher
+}
+
+// Recv will return the next message from the client
+func (c *secureConn) Recv() ([]byte, error) {
+	f, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.open.Open(f.Counter, f.Ciphertext)
+}
+
+// Send will seal a message and send it to the client
+func (c *secureConn) Send(msg []byte) error {
+	n, ciphertext, err := c.seal.Seal(msg)
+	if err != nil {
+		return err
+	}
+
+	return c.stream.Send(&pb.SecureFrame{
+		Counter:    n,
+		Ciphertext: ciphertext,
+	})
+}
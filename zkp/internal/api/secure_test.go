@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/client"
+	"github.com/imthaghost/goland/zkp/internal/channel"
+	hsinmemory "github.com/imthaghost/goland/zkp/internal/handshake/inmemory"
+	"github.com/imthaghost/goland/zkp/internal/totp"
+)
+
+// keyTimes is a channel.KeyService that remembers until when each key is kept
+type keyTimes struct {
+	mu    sync.Mutex
+	keys  map[string][]byte
+	until map[string]time.Time
+}
+
+func newKeyTimes() *keyTimes {
+	return &keyTimes{keys: make(map[string][]byte), until: make(map[string]time.Time)}
+}
+
+func (k *keyTimes) Put(sessionID string, key []byte, until time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[sessionID] = key
+	k.until[sessionID] = until
+	return nil
+}
+
+func (k *keyTimes) Get(sessionID string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[sessionID]
+	if !ok {
+		return nil, channel.ErrNotFound
+	}
+	return key, nil
+}
+
+func (k *keyTimes) Delete(sessionID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, sessionID)
+	delete(k.until, sessionID)
+	return nil
+}
+
+// only returns the one key kept, failing the test unless there is exactly one
+func (k *keyTimes) only(t *testing.T) time.Time {
+	t.Helper()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.until) != 1 {
+		t.Fatalf("%d session keys kept, want 1", len(k.until))
+	}
+	for _, until := range k.until {
+		return until
+	}
+	return time.Time{}
+}
+
+// near reports whether got is within a few seconds of want
+func near(got, want time.Time) bool {
+	d := got.Sub(want)
+	return d > -5*time.Second && d < 5*time.Second
+}
+
+func TestSessionKeyLifetime(t *testing.T) {
+	keys := newKeyTimes()
+	ts := newTestServer(t, func(s *Server) {
+		challenges := hsinmemory.New(time.Minute)
+		t.Cleanup(challenges.Close)
+		s.ChallengeService = challenges
+		s.KeyService = keys
+	})
+	ts.register(t, "alice", "hunter2")
+	ctx := context.Background()
+
+	// a plain login keeps K for as long as the session can be refreshed
+	c, _ := ts.login(t, "alice", "hunter2")
+	if until := keys.only(t); !near(until, time.Now().Add(ts.RefreshTTL)) {
+		t.Errorf("key kept until %v after Login, want %v from now", until, ts.RefreshTTL)
+	}
+
+	enrollment, err := c.EnrollTOTP(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() error = %v", err)
+	}
+	secret, err := totp.DecodeSecret(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ConfirmTOTP(ctx, totp.Code(secret, totp.Step(time.Now()))); err != nil {
+		t.Fatalf("ConfirmTOTP() error = %v", err)
+	}
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+
+	// with a second factor pending K is only kept as long as the challenge
+	_, err = ts.client().Login(ctx, "alice", "hunter2")
+	var pending *client.SecondFactorRequired
+	if !errors.As(err, &pending) {
+		t.Fatalf("Login() error = %v, want %T", err, pending)
+	}
+	if until := keys.only(t); !near(until, pending.ExpiresAt) {
+		t.Errorf("key kept until %v while the challenge is pending, want %v", until, pending.ExpiresAt)
+	}
+
+	// a recovery code, the TOTP code was used up by ConfirmTOTP
+	if _, err := ts.client().VerifyTOTP(ctx, pending, enrollment.RecoveryCodes[0]); err != nil {
+		t.Fatalf("VerifyTOTP() error = %v", err)
+	}
+	if until := keys.only(t); !near(until, time.Now().Add(ts.RefreshTTL)) {
+		t.Errorf("key kept until %v after VerifyTOTP, want %v from now", until, ts.RefreshTTL)
+	}
+}
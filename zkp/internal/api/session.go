@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+	"github.com/imthaghost/goland/zkp/internal/token"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RefreshToken exchanges a refresh token for a new session token and refresh token
+func (s *Server) RefreshToken(ctx context.Context, request *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	if request == nil || request.RefreshToken == "" {
+		return nil, invalidArgument("refresh_token", "refresh token is required")
+	}
+
+	rt, err := s.StoreService.UseRefreshToken(token.HashRefreshToken(request.RefreshToken))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not use refresh token")
+	}
+
+	// refresh tokens are single use, seeing one twice means it was stolen so
+	// we end the session for the thief and the legitimate user alike
+	if rt.Used {
+		if err := s.StoreService.RevokeSession(rt.SessionID, rt.ExpiresAt); err != nil {
+			return nil, status.Error(codes.Internal, "could not revoke session")
+		}
+		if err := s.forgetKey(rt.SessionID); err != nil {
+			return nil, status.Error(codes.Internal, "could not revoke session")
+		}
+		s.emit(ctx, rt.Tenant, audit.RefreshReused, rt.Username, rt.SessionID, nil)
+		return nil, status.Error(codes.Unauthenticated, "refresh token reuse detected")
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return nil, status.Error(codes.Unauthenticated, "refresh token expired")
+	}
+
+	t, err := s.getTenant(rt.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+	revoked, err := s.StoreService.IsRevoked(t.ID, rt.Username, rt.SessionID, rt.IssuedAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not check revocation")
+	}
+	if revoked {
+		return nil, status.Error(codes.Unauthenticated, errRevoked.Error())
+	}
+
+	tok, claims, refresh, err := s.issueSession(t, rt.Username, rt.SessionID, rt.IssuedAt, rt.ExpiresAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not issue token")
+	}
+
+	resp := pb.RefreshTokenResponse{
+		Token:        tok,
+		ExpiresAt:    claims.ExpiresAt,
+		RefreshToken: refresh,
+	}
+	return &resp, nil
+}
+
+// Logout revokes the session of the bearer token
+func (s *Server) Logout(ctx context.Context, request *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	claims, err := s.authenticateAny(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.getTenant(claims.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+
+	// no token of the session can outlive its refresh tokens
+	if err := s.StoreService.RevokeSession(claims.SessionID, time.Now().Add(s.refreshTTL(t))); err != nil {
+		return nil, status.Error(codes.Internal, "could not revoke session")
+	}
+	if err := s.forgetKey(claims.SessionID); err != nil {
+		return nil, status.Error(codes.Internal, "could not revoke session")
+	}
+	s.emit(ctx, t.ID, audit.LoggedOut, claims.Subject, claims.SessionID, nil)
+
+	return &pb.LogoutResponse{}, nil
+}
+
+// RevokeAllSessions revokes every session of the bearer token's user, including its own
+func (s *Server) RevokeAllSessions(ctx context.Context, request *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.getTenant(claims.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+
+	// tokens only carry their issue time to the second, so the cutoff does too
+	// otherwise a login right after this call would be born revoked
+	if err := s.StoreService.RevokeUserSessions(t.ID, claims.Subject, time.Now().Truncate(time.Second)); err != nil {
+		return nil, status.Error(codes.Internal, "could not revoke sessions")
+	}
+	// which means our own token may share the cutoff second, so end it explicitly
+	if err := s.StoreService.RevokeSession(claims.SessionID, time.Now().Add(s.refreshTTL(t))); err != nil {
+		return nil, status.Error(codes.Internal, "could not revoke session")
+	}
+	if err := s.forgetKey(claims.SessionID); err != nil {
+		return nil, status.Error(codes.Internal, "could not revoke session")
+	}
+	s.emit(ctx, t.ID, audit.SessionsRevoked, claims.Subject, claims.SessionID, nil)
+
+	return &pb.RevokeAllSessionsResponse{}, nil
+}
+
+// endSessions revokes every session of an account and forgets their keys.
+// The cutoff only goes to the second like tokens do, so the sessions we
+// know of are also revoked one by one.
+func (s *Server) endSessions(t *store.Tenant, username string) error {
+	now := time.Now()
+	if err := s.StoreService.RevokeUserSessions(t.ID, username, now.Truncate(time.Second)); err != nil {
+		return status.Error(codes.Internal, "could not revoke sessions")
+	}
+
+	tokens, err := s.StoreService.ListRefreshTokens(t.ID, username)
+	if err != nil {
+		return status.Error(codes.Internal, "could not list sessions")
+	}
+	for _, rt := range tokens {
+		if err := s.StoreService.RevokeSession(rt.SessionID, now.Add(s.refreshTTL(t))); err != nil {
+			return status.Error(codes.Internal, "could not revoke session")
+		}
+		if err := s.forgetKey(rt.SessionID); err != nil {
+			return status.Error(codes.Internal, "could not revoke session")
+		}
+	}
+
+	return nil
+}
+
+// IntrospectToken tells other services whether a session token is still good
+func (s *Server) IntrospectToken(ctx context.Context, request *pb.IntrospectTokenRequest) (*pb.IntrospectTokenResponse, error) {
+	if request == nil || request.Token == "" {
+		return nil, invalidArgument("token", "token is required")
+	}
+
+	// a password reset token is no session, other services must not take it
+	claims, err := s.checkToken(request.Token)
+	if err != nil || claims.Scope != "" {
+		return &pb.IntrospectTokenResponse{}, nil
+	}
+
+	resp := pb.IntrospectTokenResponse{
+		Active:    true,
+		TenantId:  tenant.Normalize(claims.Tenant),
+		Username:  claims.Subject,
+		SessionId: claims.SessionID,
+		IssuedAt:  claims.IssuedAt,
+		ExpiresAt: claims.ExpiresAt,
+	}
+	return &resp, nil
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// refresh trades a refresh token directly, without a client keeping track
+func refresh(ts *testServer, refreshToken string) (*pb.RefreshTokenResponse, error) {
+	return ts.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: refreshToken})
+}
+
+func TestRefreshToken(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register(t, "alice", "hunter2")
+
+	tests := []struct {
+		name string
+		// run gets a fresh session and returns the refresh tokens it expects to fail
+		run      func(t *testing.T, session *pb.RefreshTokenResponse, first string) []string
+		wantCode codes.Code
+		// wantActive is whether the last session token is still good afterwards
+		wantActive bool
+	}{
+		{
+			name: "rotates",
+			run: func(t *testing.T, session *pb.RefreshTokenResponse, first string) []string {
+				if session.RefreshToken == first {
+					t.Error("RefreshToken() handed back the same refresh token")
+				}
+				return nil
+			},
+			wantActive: true,
+		},
+		{
+			// reuse means the token was stolen, nobody keeps the session
+			name: "reuse revokes the session",
+			run: func(t *testing.T, session *pb.RefreshTokenResponse, first string) []string {
+				return []string{first, session.RefreshToken}
+			},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name: "unknown",
+			run: func(t *testing.T, session *pb.RefreshTokenResponse, first string) []string {
+				return []string{"not a refresh token"}
+			},
+			wantCode:   codes.Unauthenticated,
+			wantActive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, session := ts.login(t, "alice", "hunter2")
+			rotated, err := refresh(ts, session.RefreshToken)
+			if err != nil {
+				t.Fatalf("RefreshToken() error = %v", err)
+			}
+			if !ts.active(t, rotated.Token) {
+				t.Fatal("refreshed token is not active")
+			}
+
+			for _, rt := range tt.run(t, rotated, session.RefreshToken) {
+				if _, err := refresh(ts, rt); status.Code(err) != tt.wantCode {
+					t.Errorf("RefreshToken() error = %v, want %v", err, tt.wantCode)
+				}
+			}
+			if got := ts.active(t, rotated.Token); got != tt.wantActive {
+				t.Errorf("token active = %v, want %v", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseLeavesOtherSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register(t, "alice", "hunter2")
+
+	_, stolen := ts.login(t, "alice", "hunter2")
+	_, other := ts.login(t, "alice", "hunter2")
+
+	if _, err := refresh(ts, stolen.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if _, err := refresh(ts, stolen.RefreshToken); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("RefreshToken() reused error = %v, want %v", err, codes.Unauthenticated)
+	}
+
+	if !ts.active(t, other.Token) {
+		t.Error("reuse in one session revoked another")
+	}
+	if _, err := refresh(ts, other.RefreshToken); err != nil {
+		t.Errorf("RefreshToken() of the other session error = %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register(t, "alice", "hunter2")
+
+	c, session := ts.login(t, "alice", "hunter2")
+	_, other := ts.login(t, "alice", "hunter2")
+
+	if err := c.Logout(context.Background()); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+
+	if ts.active(t, session.Token) {
+		t.Error("token is still active after Logout")
+	}
+	if _, err := refresh(ts, session.RefreshToken); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("RefreshToken() after Logout error = %v, want %v", err, codes.Unauthenticated)
+	}
+	if !ts.active(t, other.Token) {
+		t.Error("Logout ended another session")
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register(t, "alice", "hunter2")
+	ts.register(t, "bob", "hunter2")
+
+	c, session := ts.login(t, "alice", "hunter2")
+	_, other := ts.login(t, "alice", "hunter2")
+	_, bob := ts.login(t, "bob", "hunter2")
+
+	// the cutoff is to the second like the issue time of tokens, sessions
+	// from the second of the call itself are only caught by their own ID
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	ctx, err := c.AuthContext(context.Background())
+	if err != nil {
+		t.Fatalf("AuthContext() error = %v", err)
+	}
+	if _, err := c.Auth.RevokeAllSessions(ctx, &pb.RevokeAllSessionsRequest{}); err != nil {
+		t.Fatalf("RevokeAllSessions() error = %v", err)
+	}
+
+	for _, s := range []struct {
+		name         string
+		token        string
+		refreshToken string
+	}{
+		{"own", session.Token, session.RefreshToken},
+		{"other", other.Token, other.RefreshToken},
+	} {
+		if ts.active(t, s.token) {
+			t.Errorf("%s session is still active", s.name)
+		}
+		if _, err := refresh(ts, s.refreshToken); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("RefreshToken() of the %s session error = %v, want %v", s.name, err, codes.Unauthenticated)
+		}
+	}
+	if !ts.active(t, bob.Token) {
+		t.Error("another user's session was revoked")
+	}
+
+	// logging in again right away is not caught by the cutoff
+	_, again := ts.login(t, "alice", "hunter2")
+	if !ts.active(t, again.Token) {
+		t.Error("a new session right after RevokeAllSessions is not active")
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/password"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxTenantNameLength is the longest display name of a tenant
+const maxTenantNameLength = 256
+
+// tenant returns the tenant a call without a token is for, named by the
+// request's tenant_id field or x-tenant-id metadata
+func (s *Server) tenant(ctx context.Context, req interface{}) (*store.Tenant, error) {
+	field, md := tenant.FromRequest(req), tenant.FromMetadata(ctx)
+	if field != "" && md != "" && field != md {
+		return nil, invalidArgument("tenant_id", "tenant_id and x-tenant-id metadata disagree")
+	}
+
+	return s.getTenant(tenant.FromContext(ctx, req))
+}
+
+// getTenant returns the tenant with the given ID, which came from a caller
+func (s *Server) getTenant(id string) (*store.Tenant, error) {
+	id = tenant.Normalize(id)
+	if err := tenant.Validate(id); err != nil {
+		return nil, invalidArgument("tenant_id", err.Error())
+	}
+
+	t, err := s.StoreService.GetTenant(id)
+	if errors.Is(err, store.ErrTenantNotFound) {
+		return nil, invalidArgument("tenant_id", "unknown tenant")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+
+	return t, nil
+}
+
+// kdfPolicy returns the KDF users of the tenant should be on, and whether
+// new verifiers must be at least as strong
+func (s *Server) kdfPolicy(t *store.Tenant) (kdf.Params, bool) {
+	if t.Policy.MinKDF != nil {
+		return *t.Policy.MinKDF, true
+	}
+
+	return s.KDFPolicy, false
+}
+
+// refreshTTL returns how long sessions of the tenant can be kept alive
+func (s *Server) refreshTTL(t *store.Tenant) time.Duration {
+	if t.Policy.RefreshTTL > 0 {
+		return t.Policy.RefreshTTL
+	}
+
+	return s.RefreshTTL
+}
+
+// groups returns the groups new verifiers of the tenant may be made for,
+// the server's when the tenant does not pick any it still supports
+func (s *Server) groups(t *store.Tenant) []password.Group {
+	if groups := s.tenantGroups(t); len(groups) > 0 {
+		return groups
+	}
+
+	return s.PasswordService.Groups()
+}
+
+// defaultGroup returns the group new verifiers of the tenant should be made
+// for, the first one the tenant picked
+func (s *Server) defaultGroup(t *store.Tenant) password.Group {
+	if groups := s.tenantGroups(t); len(groups) > 0 {
+		return groups[0]
+	}
+
+	return s.PasswordService.DefaultGroup()
+}
+
+// tenantGroups returns the groups the tenant picked that are still supported
+func (s *Server) tenantGroups(t *store.Tenant) []password.Group {
+	var groups []password.Group
+	for _, id := range t.Policy.Groups {
+		if g, err := s.PasswordService.Group(id); err == nil && g.Bits() >= s.PasswordService.MinBits() {
+			groups = append(groups, g)
+		}
+	}
+
+	return groups
+}
+
+// allowed reports whether g is one of groups
+func allowed(groups []password.Group, g password.Group) bool {
+	for _, a := range groups {
+		if a.ID() == g.ID() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateTenant adds a tenant, admins only
+func (s *Server) CreateTenant(ctx context.Context, request *pb.CreateTenantRequest) (*pb.CreateTenantResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if request == nil || request.Tenant == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+
+	t, err := s.tenantFromProto(request.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	t.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	err = s.StoreService.CreateTenant(t)
+	if errors.Is(err, store.ErrTenantExists) {
+		return nil, status.Error(codes.AlreadyExists, "tenant already exists")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not create tenant")
+	}
+
+	return &pb.CreateTenantResponse{Tenant: tenantToProto(t)}, nil
+}
+
+// ListTenants returns every tenant, admins only
+func (s *Server) ListTenants(ctx context.Context, request *pb.ListTenantsRequest) (*pb.ListTenantsResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	tenants, err := s.StoreService.ListTenants()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not list tenants")
+	}
+
+	resp := pb.ListTenantsResponse{}
+	for _, t := range tenants {
+		resp.Tenants = append(resp.Tenants, tenantToProto(t))
+	}
+	return &resp, nil
+}
+
+// tenantFromProto checks a tenant sent by an admin
+func (s *Server) tenantFromProto(p *pb.Tenant) (*store.Tenant, error) {
+	if err := tenant.Validate(p.Id); err != nil {
+		return nil, invalidArgument("tenant.id", err.Error())
+	}
+	if len(p.Name) > maxTenantNameLength {
+		return nil, invalidArgument("tenant.name", "name is too long")
+	}
+
+	t := &store.Tenant{
+		ID:   p.Id,
+		Name: p.Name,
+	}
+	policy := p.GetPolicy()
+	for _, id := range policy.GetGroupIds() {
+		g, err := s.PasswordService.Group(id)
+		if err != nil {
+			return nil, invalidArgument("tenant.policy.group_ids", fmt.Sprintf("unsupported group %q, see GetParameters", id))
+		}
+		if g.Bits() < s.PasswordService.MinBits() {
+			return nil, invalidArgument("tenant.policy.group_ids", fmt.Sprintf("group %q is smaller than %d bits", id, s.PasswordService.MinBits()))
+		}
+		t.Policy.Groups = append(t.Policy.Groups, id)
+	}
+	if policy.GetMinKdf() != nil {
+		k := kdfFromProto(policy.MinKdf)
+		if err := k.Validate(); err != nil {
+			return nil, invalidArgument("tenant.policy.min_kdf", err.Error())
+		}
+		t.Policy.MinKDF = &k
+	}
+	if policy.GetLockoutThreshold() < 0 || policy.GetTokenTtlSeconds() < 0 || policy.GetRefreshTtlSeconds() < 0 {
+		return nil, invalidArgument("tenant.policy", "limits cannot be negative")
+	}
+	t.Policy.LockoutThreshold = int(policy.GetLockoutThreshold())
+	t.Policy.TokenTTL = time.Duration(policy.GetTokenTtlSeconds()) * time.Second
+	t.Policy.RefreshTTL = time.Duration(policy.GetRefreshTtlSeconds()) * time.Second
+
+	return t, nil
+}
+
+// tenantToProto turns a stored tenant into its wire form
+func tenantToProto(t *store.Tenant) *pb.Tenant {
+	p := &pb.Tenant{
+		Id:   t.ID,
+		Name: t.Name,
+		Policy: &pb.TenantPolicy{
+			GroupIds:          t.Policy.Groups,
+			LockoutThreshold:  int32(t.Policy.LockoutThreshold),
+			TokenTtlSeconds:   int64(t.Policy.TokenTTL / time.Second),
+			RefreshTtlSeconds: int64(t.Policy.RefreshTTL / time.Second),
+		},
+	}
+	if t.Policy.MinKDF != nil {
+		p.Policy.MinKdf = kdfToProto(*t.Policy.MinKDF)
+	}
+	if !t.CreatedAt.IsZero() {
+		p.CreatedAt = t.CreatedAt.Unix()
+	}
+
+	return p
+}
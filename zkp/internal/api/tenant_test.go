@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/client"
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTenantServer serves a Server with an acme tenant next to the default
+// one, acme has short tokens and locks accounts after one bad proof
+func newTenantServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ts := newTestServer(t, func(s *Server) {
+		s.Limiter = ratelimit.New(ratelimit.Config{LockoutThreshold: 5, LockoutBase: time.Minute})
+	})
+	err := ts.StoreService.CreateTenant(&store.Tenant{
+		ID:     "acme",
+		Policy: store.Policy{LockoutThreshold: 1, TokenTTL: 5 * time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	return ts
+}
+
+// in returns a client of the tenant
+func (ts *testServer) in(tenantID string) *client.Client {
+	return client.New(ts.conn, client.WithRetries(0, 0), client.WithTenant(tenantID))
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ts := newTenantServer(t)
+	ctx := context.Background()
+
+	// the same username is two users with passwords of their own
+	if err := ts.in(tenant.Default).Register(ctx, "alice", "hunter2"); err != nil {
+		t.Fatalf("Register(alice) error = %v", err)
+	}
+	if err := ts.in("acme").Register(ctx, "alice", "correct horse"); err != nil {
+		t.Fatalf("Register(alice) in acme error = %v", err)
+	}
+
+	home, err := ts.in(tenant.Default).Login(ctx, "alice", "hunter2")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	acme := ts.in("acme")
+	away, err := acme.Login(ctx, "alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login() in acme error = %v", err)
+	}
+
+	// each tenant's policy applies to its own sessions only
+	if got := time.Until(away.ExpiresAt); got > 5*time.Minute {
+		t.Errorf("acme token expires in %v, want at most %v", got, 5*time.Minute)
+	}
+	if got := time.Until(home.ExpiresAt); got <= 5*time.Minute {
+		t.Errorf("default tenant token expires in %v, want the server's TTL", got)
+	}
+	resp, err := ts.IntrospectToken(ctx, &pb.IntrospectTokenRequest{Token: away.Token})
+	if err != nil {
+		t.Fatalf("IntrospectToken() error = %v", err)
+	}
+	if resp.TenantId != "acme" {
+		t.Errorf("acme token is for tenant %q, want acme", resp.TenantId)
+	}
+
+	// ending the acme session leaves the other alice logged in
+	if err := acme.Logout(ctx); err != nil {
+		t.Fatalf("Logout() in acme error = %v", err)
+	}
+	if ts.active(t, away.Token) {
+		t.Error("acme session is still active after Logout")
+	}
+	if !ts.active(t, home.Token) {
+		t.Error("default tenant session ended with the acme one")
+	}
+
+	// the default tenant's password is wrong in acme, where one bad proof
+	// locks alice, and only there
+	if _, err := ts.in("acme").Login(ctx, "alice", "hunter2"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Login() in acme with the default tenant's password error = %v, want %v", err, codes.Unauthenticated)
+	}
+	if _, err := ts.in("acme").Login(ctx, "alice", "correct horse"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Login() of a locked account error = %v, want %v", err, codes.ResourceExhausted)
+	}
+	if _, err := ts.in(tenant.Default).Login(ctx, "alice", "hunter2"); err != nil {
+		t.Errorf("Login() in the default tenant error = %v", err)
+	}
+}
+
+func TestBadTenant(t *testing.T) {
+	ts := newTenantServer(t)
+	ts.register(t, "alice", "hunter2")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *pb.LoginRequest
+	}{
+		{
+			name: "malformed",
+			ctx:  context.Background(),
+			req:  &pb.LoginRequest{Username: "alice", TenantId: "Acme Corp"},
+		},
+		{
+			name: "unknown",
+			ctx:  context.Background(),
+			req:  &pb.LoginRequest{Username: "alice", TenantId: "globex"},
+		},
+		{
+			name: "unknown in metadata",
+			ctx:  metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "globex")),
+			req:  &pb.LoginRequest{Username: "alice"},
+		},
+		{
+			name: "field and metadata disagree",
+			ctx:  metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "acme")),
+			req:  &pb.LoginRequest{Username: "alice", TenantId: tenant.Default},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.PublicKey = "02"
+			if _, err := ts.Login(tt.ctx, tt.req); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Login() error = %v, want %v", err, codes.InvalidArgument)
+			}
+		})
+	}
+}
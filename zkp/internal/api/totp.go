@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+	"github.com/imthaghost/goland/zkp/internal/token"
+	"github.com/imthaghost/goland/zkp/internal/totp"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errNoSecondFactor = errors.New("no second factor enrolled")
+	errEnrolled       = errors.New("second factor already enrolled")
+	errBadCode        = errors.New("bad code")
+)
+
+// EnrollTOTP makes a new TOTP secret and recovery codes for the bearer
+// token's user. Nothing changes for logins until ConfirmTOTP.
+func (s *Server) EnrollTOTP(ctx context.Context, request *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	if s.ChallengeService == nil {
+		return nil, status.Error(codes.Unimplemented, "second factor is not available")
+	}
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not make secret")
+	}
+	recovery, err := totp.NewRecoveryCodes(totp.RecoveryCodes)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not make recovery codes")
+	}
+	hashes := make([]string, len(recovery))
+	for i, c := range recovery {
+		if hashes[i], err = totp.HashRecoveryCode(c); err != nil {
+			return nil, status.Error(codes.Internal, "could not make recovery codes")
+		}
+	}
+
+	// enrolling again before confirming replaces the pending secret
+	err = s.StoreService.ModifyUser(claims.Tenant, claims.Subject, func(u *store.User) error {
+		if u.TOTP != nil && u.TOTP.Confirmed {
+			return errEnrolled
+		}
+		u.TOTP = &store.TOTP{
+			Secret:        totp.EncodeSecret(secret),
+			RecoveryCodes: hashes,
+		}
+		return nil
+	})
+	if errors.Is(err, errEnrolled) {
+		return nil, status.Error(codes.AlreadyExists, errEnrolled.Error())
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, userError(codes.NotFound, claims.Subject, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not store secret")
+	}
+
+	resp := pb.EnrollTOTPResponse{
+		Uri:           totp.URI(s.TOTPIssuer, claims.Subject, secret),
+		Secret:        totp.EncodeSecret(secret),
+		RecoveryCodes: recovery,
+	}
+	return &resp, nil
+}
+
+// ConfirmTOTP checks a first code against the pending secret, from then on
+// every login asks for one
+func (s *Server) ConfirmTOTP(ctx context.Context, request *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	if request == nil || !totp.IsCode(request.Code) {
+		return nil, invalidArgument("code", "code must be 6 digits")
+	}
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.StoreService.ModifyUser(claims.Tenant, claims.Subject, func(u *store.User) error {
+		if u.TOTP == nil {
+			return errNoSecondFactor
+		}
+		if u.TOTP.Confirmed {
+			return errEnrolled
+		}
+		step, err := checkCode(u.TOTP, request.Code)
+		if err != nil {
+			return err
+		}
+		u.TOTP.Confirmed = true
+		u.TOTP.LastStep = step
+		return nil
+	})
+	switch {
+	case errors.Is(err, errNoSecondFactor):
+		return nil, status.Error(codes.FailedPrecondition, "call EnrollTOTP first")
+	case errors.Is(err, errEnrolled):
+		return nil, status.Error(codes.AlreadyExists, errEnrolled.Error())
+	case errors.Is(err, errBadCode):
+		return nil, invalidArgument("code", "code does not match, check the clock of your device")
+	case errors.Is(err, store.ErrNotFound):
+		return nil, userError(codes.NotFound, claims.Subject, "user not found")
+	case err != nil:
+		return nil, status.Error(codes.Internal, "could not confirm second factor")
+	}
+	s.emit(ctx, claims.Tenant, audit.TOTPEnrolled, claims.Subject, claims.SessionID, nil)
+
+	return &pb.ConfirmTOTPResponse{}, nil
+}
+
+// VerifyTOTP finishes a login waiting for a second factor. Challenges are
+// single use, a wrong code means starting the login over.
+func (s *Server) VerifyTOTP(ctx context.Context, request *pb.VerifyTOTPRequest) (*pb.VerifyTOTPResponse, error) {
+	if request == nil || request.Code == "" {
+		return nil, invalidArgument("code", "code is required")
+	}
+	if s.ChallengeService == nil {
+		return nil, status.Error(codes.Unimplemented, "second factor is not available")
+	}
+
+	ch, err := s.ChallengeService.Take(request.Challenge)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "no second factor challenge in progress")
+	}
+	t, err := s.getTenant(ch.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+	// the rate limit interceptor can not see the username here
+	if locked, _ := s.Limiter.Locked(tenant.Key(t.ID, ch.Username)); locked {
+		return nil, status.Error(codes.ResourceExhausted, "account is temporarily locked")
+	}
+
+	method, remaining := "totp", 0
+	err = s.StoreService.ModifyUser(t.ID, ch.Username, func(u *store.User) error {
+		if u.TOTP == nil || !u.TOTP.Confirmed {
+			return errNoSecondFactor
+		}
+		if totp.IsCode(request.Code) {
+			step, err := checkCode(u.TOTP, request.Code)
+			if err != nil {
+				return err
+			}
+			u.TOTP.LastStep = step
+			return nil
+		}
+
+		method = "recovery_code"
+		for i, h := range u.TOTP.RecoveryCodes {
+			if totp.CheckRecoveryCode(request.Code, h) {
+				u.TOTP.RecoveryCodes = append(u.TOTP.RecoveryCodes[:i], u.TOTP.RecoveryCodes[i+1:]...)
+				remaining = len(u.TOTP.RecoveryCodes)
+				return nil
+			}
+		}
+		return errBadCode
+	})
+	if errors.Is(err, errBadCode) {
+		s.failed(ctx, t, ch.Username, ch.SessionID, "bad code", "login")
+		return nil, status.Error(codes.Unauthenticated, "bad code")
+	}
+	// the second factor was removed while the challenge was out
+	if errors.Is(err, errNoSecondFactor) || errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "login again")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not check code")
+	}
+	s.Limiter.Success(tenant.Key(t.ID, ch.Username))
+
+	revoked, err := s.StoreService.IsRevoked(t.ID, ch.Username, ch.SessionID, ch.CreatedAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not check revocation")
+	}
+	if revoked {
+		s.emit(ctx, t.ID, audit.LoginFailed, ch.Username, ch.SessionID, map[string]string{"reason": "revoked"})
+		return nil, status.Error(codes.Unauthenticated, errRevoked.Error())
+	}
+
+	var tok, refresh string
+	var claims *token.Claims
+	var until time.Time
+	if ch.ResetRequired {
+		tok, claims, err = s.issueResetToken(t, ch.Username, ch.SessionID)
+		if err == nil {
+			until = time.Unix(claims.ExpiresAt, 0)
+		}
+	} else {
+		now := time.Now()
+		until = now.Add(s.refreshTTL(t))
+		tok, claims, refresh, err = s.issueSession(t, ch.Username, ch.SessionID, now, until)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not issue token")
+	}
+	// Validate only kept K for as long as the challenge
+	if err := s.extendKey(ch.SessionID, until); err != nil {
+		return nil, status.Error(codes.Internal, "could not keep session key")
+	}
+	detail := map[string]string{"second_factor": method}
+	if claims.Scope != "" {
+		detail["scope"] = claims.Scope
+	}
+	s.emit(ctx, t.ID, audit.LoginSucceeded, ch.Username, ch.SessionID, detail)
+	if method == "recovery_code" {
+		s.emit(ctx, t.ID, audit.RecoveryCodeUsed, ch.Username, ch.SessionID, map[string]string{
+			"remaining": strconv.Itoa(remaining),
+		})
+	}
+
+	resp := pb.VerifyTOTPResponse{
+		Token:        tok,
+		ExpiresAt:    claims.ExpiresAt,
+		RefreshToken: refresh,
+
+		PasswordResetRequired: ch.ResetRequired,
+	}
+	return &resp, nil
+}
+
+// checkCode checks a TOTP code against the user's secret and returns the
+// time step it was made for
+func checkCode(t *store.TOTP, code string) (int64, error) {
+	secret, err := totp.DecodeSecret(t.Secret)
+	if err != nil {
+		return 0, err
+	}
+	step, ok := totp.Verify(secret, code, time.Now(), t.LastStep)
+	if !ok {
+		return 0, errBadCode
+	}
+
+	return step, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Validate(ctx context.Context, request *pb.ValidateRequest) (*pb.ValidateResponse, error) {
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+
+	proof, err := hex.DecodeString(request.Proof)
+	if err != nil || len(proof) == 0 {
+		return nil, invalidArgument("proof", "malformed proof")
+	}
+
+	// taking the handshake means a proof can only ever be checked once
+	hs, err := s.HandshakeService.Take(request.HandshakeId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "no login in progress")
+	}
+
+	t, err := s.getTenant(hs.Tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve tenant")
+	}
+	// the handshake may have been opened before the account was locked
+	if locked, _ := s.Limiter.Locked(tenant.Key(t.ID, hs.Username)); locked {
+		return nil, status.Error(codes.ResourceExhausted, "account is temporarily locked")
+	}
+
+	serverProof, err := hs.Server.Verify(proof)
+	if err != nil {
+		s.failedProof(ctx, t, hs.Username, hs.ID, "login")
+		return nil, status.Error(codes.Unauthenticated, "bad proof")
+	}
+	s.Limiter.Success(tenant.Key(t.ID, hs.Username))
+	if hs.Locked {
+		s.emit(ctx, t.ID, audit.LoginFailed, hs.Username, hs.ID, map[string]string{"reason": "locked by admin"})
+		return nil, status.Error(codes.PermissionDenied, "account is locked")
+	}
+
+	// sessions revoked while the handshake was in flight stay revoked
+	revoked, err := s.StoreService.IsRevoked(t.ID, hs.Username, hs.ID, hs.CreatedAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not check revocation")
+	}
+	if revoked {
+		s.emit(ctx, t.ID, audit.LoginFailed, hs.Username, hs.ID, map[string]string{"reason": "revoked"})
+		return nil, status.Error(codes.Unauthenticated, errRevoked.Error())
+	}
+
+	resp := pb.ValidateResponse{
+		ServerProof: hex.EncodeToString(serverProof),
+	}
+	if hs.Upgrade {
+		policy, _ := s.kdfPolicy(t)
+		resp.UpgradeKdf = kdfToProto(policy)
+	}
+
+	// the password is right but the token has to wait for the second factor
+	if hs.SecondFactor {
+		if s.ChallengeService == nil {
+			return nil, status.Error(codes.Internal, "second factor is not available")
+		}
+		ch := &handshake.Session{
+			Tenant:    t.ID,
+			Username:  hs.Username,
+			SessionID: hs.ID,
+
+			ResetRequired: hs.ResetRequired,
+		}
+		id, err := s.ChallengeService.Create(ch)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not create challenge")
+		}
+		// K outlives the challenge only once VerifyTOTP issues the session
+		if err := s.keepKey(hs.ID, hs.Server, ch.ExpiresAt); err != nil {
+			return nil, status.Error(codes.Internal, "could not keep session key")
+		}
+		s.emit(ctx, t.ID, audit.SecondFactorRequired, hs.Username, hs.ID, nil)
+
+		resp.SecondFactorRequired = true
+		resp.Challenge = id
+		resp.ChallengeExpiresAt = ch.ExpiresAt.Unix()
+		return &resp, nil
+	}
+
+	if hs.ResetRequired {
+		token, claims, err := s.issueResetToken(t, hs.Username, hs.ID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not issue token")
+		}
+		// ChangeVerifier hands K on to the session that replaces this one
+		if err := s.keepKey(hs.ID, hs.Server, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			return nil, status.Error(codes.Internal, "could not keep session key")
+		}
+		s.emit(ctx, t.ID, audit.LoginSucceeded, hs.Username, hs.ID, map[string]string{"scope": claims.Scope})
+
+		resp.Token = token
+		resp.ExpiresAt = claims.ExpiresAt
+		resp.PasswordResetRequired = true
+		return &resp, nil
+	}
+
+	// both sides now hold K, keep ours for SecureExchange
+	now := time.Now()
+	until := now.Add(s.refreshTTL(t))
+	if err := s.keepKey(hs.ID, hs.Server, until); err != nil {
+		return nil, status.Error(codes.Internal, "could not keep session key")
+	}
+
+	// only now that the client has proved itself do we hand out a token
+	token, claims, refresh, err := s.issueSession(t, hs.Username, hs.ID, now, until)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not issue token")
+	}
+	s.emit(ctx, t.ID, audit.LoginSucceeded, hs.Username, hs.ID, nil)
+
+	resp.Token = token
+	resp.ExpiresAt = claims.ExpiresAt
+	resp.RefreshToken = refresh
+	return &resp, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLockedAccountRefusesProof(t *testing.T) {
+	tests := []struct {
+		name string
+		// finish completes the handshake with the right proof
+		finish func(ts *testServer, id, proof string) error
+	}{
+		{
+			name: "Validate",
+			finish: func(ts *testServer, id, proof string) error {
+				_, err := ts.Validate(context.Background(), &pb.ValidateRequest{HandshakeId: id, Proof: proof})
+				return err
+			},
+		},
+		{
+			name: "ChangeVerifier",
+			finish: func(ts *testServer, id, proof string) error {
+				_, err := ts.ChangeVerifier(context.Background(), &pb.ChangeVerifierRequest{HandshakeId: id, Proof: proof})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, func(s *Server) {
+				s.Limiter = ratelimit.New(ratelimit.Config{LockoutThreshold: 1, LockoutBase: time.Minute})
+			})
+			ts.register(t, "alice", "hunter2")
+
+			// the handshake is opened before anyone guesses wrong
+			id, proof := ts.handshake(t, "alice", "hunter2")
+			if _, err := ts.client().Login(context.Background(), "alice", "hunter3"); status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("Login() with a wrong password error = %v, want %v", err, codes.Unauthenticated)
+			}
+
+			if err := tt.finish(ts, id, proof); status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("%s() of a locked account error = %v, want %v", tt.name, err, codes.ResourceExhausted)
+			}
+			if locked, _ := ts.Limiter.Locked(tenant.Key("", "alice")); !locked {
+				t.Error("the right proof lifted the lockout")
+			}
+		})
+	}
+}
+
+func TestValidateHandshake(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register(t, "alice", "hunter2")
+
+	id, proof := ts.handshake(t, "alice", "hunter2")
+	resp, err := ts.Validate(context.Background(), &pb.ValidateRequest{HandshakeId: id, Proof: proof})
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !ts.active(t, resp.Token) {
+		t.Error("token from Validate is not active")
+	}
+
+	// a proof is only ever checked once
+	if _, err := ts.Validate(context.Background(), &pb.ValidateRequest{HandshakeId: id, Proof: proof}); status.Code(err) != codes.NotFound {
+		t.Errorf("Validate() again error = %v, want %v", err, codes.NotFound)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChangeVerifier replaces the salt and verifier of the caller's account and
+// ends every other session, the caller gets a fresh one in return
+func (s *Server) ChangeVerifier(ctx context.Context, request *pb.ChangeVerifierRequest) (*pb.ChangeVerifierResponse, error) {
+	if request == nil {
+		return nil, status.Error(codes.InvalidArgument, "cannot have empty request")
+	}
+
+	var username, sessionID, serverProof, revokeOwn, method string
+	var t *store.Tenant
+	if request.HandshakeId != "" || request.Proof != "" {
+		// a fresh proof of the old password
+		proof, err := hex.DecodeString(request.Proof)
+		if err != nil || len(proof) == 0 {
+			return nil, invalidArgument("proof", "malformed proof")
+		}
+
+		hs, err := s.HandshakeService.Take(request.HandshakeId)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, "no login in progress")
+		}
+
+		t, err = s.getTenant(hs.Tenant)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not retrieve tenant")
+		}
+		if locked, _ := s.Limiter.Locked(tenant.Key(t.ID, hs.Username)); locked {
+			return nil, status.Error(codes.ResourceExhausted, "account is temporarily locked")
+		}
+
+		m2, err := hs.Server.Verify(proof)
+		if err != nil {
+			s.failedProof(ctx, t, hs.Username, hs.ID, "change_verifier")
+			return nil, status.Error(codes.Unauthenticated, "bad proof")
+		}
+		s.Limiter.Success(tenant.Key(t.ID, hs.Username))
+		if hs.Locked {
+			s.emit(ctx, t.ID, audit.LoginFailed, hs.Username, hs.ID, map[string]string{"reason": "locked by admin"})
+			return nil, status.Error(codes.PermissionDenied, "account is locked")
+		}
+		// the password alone must not be enough to replace it
+		if hs.SecondFactor {
+			return nil, status.Error(codes.FailedPrecondition, "second factor required, log in and change the password with a token")
+		}
+
+		if err := s.keepKey(hs.ID, hs.Server, time.Now().Add(s.refreshTTL(t))); err != nil {
+			return nil, status.Error(codes.Internal, "could not keep session key")
+		}
+
+		username, sessionID, serverProof, method = hs.Username, hs.ID, hex.EncodeToString(m2), "proof"
+	} else {
+		// this is what password reset tokens are for
+		claims, err := s.authenticateAny(ctx)
+		if err != nil {
+			return nil, err
+		}
+		t, err = s.getTenant(claims.Tenant)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not retrieve tenant")
+		}
+
+		id, err := newSessionID()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "could not create session")
+		}
+		username, sessionID, revokeOwn, method = claims.Subject, id, claims.SessionID, "token"
+	}
+
+	e, err := s.checkEnrollment(t, request.Salt, request.GroupId, request.Verifier, request.Kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.StoreService.ModifyUser(t.ID, username, func(u *store.User) error {
+		u.Salt = e.Salt
+		u.GroupID = e.GroupID
+		u.Verifier = e.Verifier
+		u.KDF = e.KDF
+		u.ResetRequired = false
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, userError(codes.NotFound, username, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not update verifier")
+	}
+	s.emit(ctx, t.ID, audit.PasswordChanged, username, sessionID, map[string]string{
+		"method":   method,
+		"group_id": e.GroupID,
+		"kdf":      e.KDF.Algorithm,
+	})
+
+	// the new session carries on the old one, key and all
+	now := time.Now()
+	if revokeOwn != "" {
+		if err := s.moveKey(revokeOwn, sessionID, now.Add(s.refreshTTL(t))); err != nil {
+			return nil, status.Error(codes.Internal, "could not keep session key")
+		}
+		// a session of a reset token has no refresh token to be found by
+		if err := s.StoreService.RevokeSession(revokeOwn, now.Add(s.refreshTTL(t))); err != nil {
+			return nil, status.Error(codes.Internal, "could not revoke session")
+		}
+	}
+	// whoever knew the old password must not keep a session
+	if err := s.endSessions(t, username); err != nil {
+		return nil, err
+	}
+
+	tok, claims, refresh, err := s.issueSession(t, username, sessionID, now, now.Add(s.refreshTTL(t)))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not issue token")
+	}
+
+	resp := pb.ChangeVerifierResponse{
+		ServerProof:  serverProof,
+		Token:        tok,
+		ExpiresAt:    claims.ExpiresAt,
+		RefreshToken: refresh,
+	}
+	return &resp, nil
+}
+
+// newSessionID returns a random session id for sessions that do not come
+// from a handshake
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/internal/channel"
+)
+
+func TestChangePassword(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.KeyService = newKeyTimes()
+		s.SecureHandler = channel.Echo{}
+	})
+	ts.register(t, "alice", "hunter2")
+	ctx := context.Background()
+
+	c, old := ts.login(t, "alice", "hunter2")
+	other, elsewhere := ts.login(t, "alice", "hunter2")
+
+	session, err := c.ChangePassword(ctx, "correct horse")
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	// every session that knew the old password ends, ours carries on
+	if ts.active(t, elsewhere.Token) {
+		t.Error("other session is still active")
+	}
+	if _, err := other.Refresh(ctx); err == nil {
+		t.Error("other session could still be refreshed")
+	}
+	if ts.active(t, old.Token) {
+		t.Error("token from before the change is still active")
+	}
+	if !ts.active(t, session.Token) {
+		t.Error("session from ChangePassword is not active")
+	}
+	if _, err := c.Refresh(ctx); err != nil {
+		t.Errorf("Refresh() of the new session error = %v", err)
+	}
+
+	// K moved with the session, so the secure channel still opens
+	conn, err := c.SecureExchange(ctx)
+	if err != nil {
+		t.Fatalf("SecureExchange() error = %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Send([]byte("ping")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if msg, err := conn.Recv(); err != nil || string(msg) != "ping" {
+		t.Errorf("Recv() = %q, %v, want ping", msg, err)
+	}
+
+	if _, err := ts.client().Login(ctx, "alice", "hunter2"); err == nil {
+		t.Error("Login() with the old password succeeded")
+	}
+	ts.login(t, "alice", "correct horse")
+}
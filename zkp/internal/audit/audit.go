@@ -0,0 +1,87 @@
+// Package audit records security relevant events such as registrations,
+// logins, lockouts and password changes. Events never carry secrets: no
+// passwords, verifiers, proofs or tokens.
+package audit
+
+import (
+	"log"
+	"time"
+)
+
+// event types
+const (
+	Registered      = "user.registered"
+	LoginStarted    = "login.started"
+	LoginSucceeded  = "login.succeeded"
+	LoginFailed     = "login.failed"
+	AccountLocked   = "account.locked"
+	PasswordChanged = "password.changed"
+	LoggedOut       = "session.logged_out"
+	SessionsRevoked = "session.revoked_all"
+	RefreshReused   = "refresh_token.reused"
+
+	SecondFactorRequired = "login.second_factor_required"
+	TOTPEnrolled         = "totp.enrolled"
+	RecoveryCodeUsed     = "totp.recovery_code_used"
+
+	AdminLocked      = "admin.account_locked"
+	AdminUnlocked    = "admin.account_unlocked"
+	AdminResetForced = "admin.password_reset_forced"
+	AdminDeleted     = "admin.account_deleted"
+)
+
+// Event is a single thing that happened
+type Event struct {
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Username  string            `json:"username,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+	Peer      string            `json:"peer,omitempty"`
+	Detail    map[string]string `json:"detail,omitempty"`
+}
+
+// Service is where the Server sends events
+type Service interface {
+	// Emit records the event, it must not block for long
+	Emit(Event)
+}
+
+// Feed hands out live events, see fanout
+type Feed interface {
+	// Subscribe returns a channel of every event from now on, which is
+	// closed if the subscriber falls more than buffer events behind or the
+	// feed shuts down, and a function to stop
+	Subscribe(buffer int) (<-chan Event, func())
+}
+
+// Sink is a single destination for events
+type Sink interface {
+	Write(Event) error
+}
+
+// Log sends every event to all of its sinks
+type Log struct {
+	sinks []Sink
+}
+
+// New will create a new Log writing to the sinks in order
+func New(sinks ...Sink) *Log {
+	return &Log{
+		sinks: sinks,
+	}
+}
+
+// Emit will stamp the event with the current time if it has none and write
+// it to every sink. A failing sink is logged and does not stop the others.
+func (l *Log) Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			log.Printf("audit: could not write %s event: %v", e.Type, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package fanout hands audit events to in-process subscribers, such as
+// WatchEvents streams.
+package fanout
+
+import (
+	"sync"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+)
+
+// Fanout is an audit.Sink that copies every event to its subscribers
+type Fanout struct {
+	mu     sync.Mutex
+	subs   map[chan audit.Event]struct{}
+	closed bool
+}
+
+// New will create a new Fanout
+func New() *Fanout {
+	return &Fanout{
+		subs: make(map[chan audit.Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel of every event from now on and a function to
+// stop. A subscriber that falls more than buffer events behind has its
+// channel closed rather than slowing everybody else down.
+func (f *Fanout) Subscribe(buffer int) (<-chan audit.Event, func()) {
+	ch := make(chan audit.Event, buffer)
+
+	f.mu.Lock()
+	if f.closed {
+		close(ch)
+	} else {
+		f.subs[ch] = struct{}{}
+	}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Write will hand the event to every subscriber without blocking
+func (f *Fanout) Write(e audit.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+
+	return nil
+}
+
+// Close will end every subscription, so streams do not hold up a shutdown
+func (f *Fanout) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		delete(f.subs, ch)
+		close(ch)
+	}
+	f.closed = true
+}
@@ -0,0 +1,193 @@
+// Package jsonl is an append-only audit log file with one JSON event per
+// line. Every line carries the hash of the line before it, so removing or
+// editing a line breaks the chain from there on.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+)
+
+// genesis is the prev hash of the first line
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// ErrBrokenChain is returned by Verify when the file has been tampered with
+var ErrBrokenChain = errors.New("audit log hash chain is broken")
+
+// record is a line in the file. Hash is sha256 over prev and the JSON of
+// the event, both as written.
+type record struct {
+	Prev  string          `json:"prev"`
+	Event json.RawMessage `json:"event"`
+	Hash  string          `json:"hash"`
+}
+
+// File is an audit.Sink appending to a file
+type File struct {
+	mu    sync.Mutex
+	f     *os.File
+	last  string
+	dirty bool // written since the last sync
+
+	syncInterval time.Duration
+	done         chan struct{}
+	stopped      chan struct{}
+}
+
+// New will open, creating if needed, the log at path and carry on its chain.
+// Writes are flushed to disk every syncInterval, a syncInterval of zero
+// flushes every event before Write returns, which costs an fsync per event.
+func New(path string, syncInterval time.Duration) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// a log we can not verify must not be extended, that would hide the break
+	last, err := Verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	fl := &File{
+		f:            f,
+		last:         last,
+		syncInterval: syncInterval,
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	if syncInterval > 0 {
+		go fl.syncLoop()
+	} else {
+		close(fl.stopped)
+	}
+
+	return fl, nil
+}
+
+// Write will append the event, it is on disk once Write returns only when
+// every event is synced
+func (fl *File) Write(e audit.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	r := record{
+		Prev:  fl.last,
+		Event: data,
+		Hash:  hash(fl.last, data),
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := fl.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	fl.last = r.Hash
+	if fl.syncInterval > 0 {
+		fl.dirty = true
+		return nil
+	}
+
+	return fl.f.Sync()
+}
+
+// syncLoop will flush what was written every syncInterval until Close
+func (fl *File) syncLoop() {
+	defer close(fl.stopped)
+
+	t := time.NewTicker(fl.syncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-fl.done:
+			return
+		case <-t.C:
+		}
+
+		// writes carry on while the file syncs
+		fl.mu.Lock()
+		dirty := fl.dirty
+		fl.dirty = false
+		fl.mu.Unlock()
+		if !dirty {
+			continue
+		}
+		if err := fl.f.Sync(); err != nil {
+			// try again on the next tick, Close reports it if it sticks
+			fl.mu.Lock()
+			fl.dirty = true
+			fl.mu.Unlock()
+		}
+	}
+}
+
+// Close will flush what is left and close the file
+func (fl *File) Close() error {
+	close(fl.done)
+	<-fl.stopped
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	if fl.dirty {
+		if err := fl.f.Sync(); err != nil {
+			fl.f.Close()
+			return err
+		}
+	}
+	return fl.f.Close()
+}
+
+// Verify will check the chain of a log from the start and return the hash
+// of its last line
+func Verify(r io.Reader) (string, error) {
+	last := genesis
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return "", fmt.Errorf("%w: line %d is not a record", ErrBrokenChain, n)
+		}
+		if rec.Prev != last || rec.Hash != hash(rec.Prev, rec.Event) {
+			return "", fmt.Errorf("%w at line %d", ErrBrokenChain, n)
+		}
+		last = rec.Hash
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+
+	return last, nil
+}
+
+// hash will chain the event onto prev
+func hash(prev string, event []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(event)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
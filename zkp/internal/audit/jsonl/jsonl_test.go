@@ -0,0 +1,85 @@
+package jsonl
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/audit"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		syncInterval time.Duration
+	}{
+		{"sync every event", 0},
+		{"sync on a timer", time.Millisecond},
+		{"sync on close", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+
+			// the chain carries on across reopens
+			for i := 0; i < 2; i++ {
+				fl, err := New(path, tt.syncInterval)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				for _, typ := range []string{"login", "logout"} {
+					if err := fl.Write(audit.Event{Time: time.Now(), Type: typ, Username: "alice"}); err != nil {
+						t.Fatalf("Write() error = %v", err)
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				if err := fl.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := bytes.Count(data, []byte("\n")); n != 4 {
+				t.Errorf("log holds %d lines, want 4", n)
+			}
+			if _, err := Verify(bytes.NewReader(data)); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNewRefusesBrokenChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	fl, err := New(path, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, typ := range []string{"login", "logout"} {
+		if err := fl.Write(audit.Event{Type: typ}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := fl.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(data, []byte("logout"), []byte("logins"), 1), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(path, 0); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("New() error = %v, want %v", err, ErrBrokenChain)
+	}
+}
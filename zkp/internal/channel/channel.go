@@ -0,0 +1,185 @@
+// Package channel seals the application messages of a SecureExchange
+// stream. Both sides hold the SRP session key K once Validate succeeds, so
+// messages can be protected end to end no matter where TLS is terminated.
+//
+// Each stream starts with both sides sending a random. The keys of the
+// stream are derived from K with HKDF-SHA256, salted with both randoms so a
+// stream never reuses the keys of another, with one AES-256-GCM key per
+// direction. Nonces are the message counter, which starts at 0 each way and
+// must go up by exactly one, so a replayed, dropped or reordered message
+// ends the stream.
+package channel
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// RandomLength is the size of the random each side starts a stream with
+const RandomLength = 32
+
+// keyLength is the size of the AES-256 key of each direction
+const keyLength = 32
+
+// info labels of the keys of each direction
+const (
+	clientInfo = "zkp secure exchange v1 client to server"
+	serverInfo = "zkp secure exchange v1 server to client"
+)
+
+var (
+	// ErrNotFound is returned when there is no session key for a session
+	ErrNotFound = errors.New("session key not found")
+	// ErrReplay is returned for a message whose counter is not the next one
+	ErrReplay = errors.New("message out of order or replayed")
+	// ErrBadMessage is returned for a message that does not open
+	ErrBadMessage = errors.New("message could not be opened")
+	// ErrExhausted is returned once a cipher has sealed as many messages as it ever may
+	ErrExhausted = errors.New("message counter exhausted, open a new stream")
+)
+
+// KeyService describes how we keep session keys from Validate until the
+// session ends. Keys must never be written anywhere they could outlive the
+// process.
+type KeyService interface {
+	// Put stores K for the session until the given time
+	Put(sessionID string, key []byte, until time.Time) error
+	// Get returns K of the session or ErrNotFound
+	Get(sessionID string) ([]byte, error)
+	// Delete forgets K of the session
+	Delete(sessionID string) error
+}
+
+// Peer is who is on the other end of a stream
+type Peer struct {
+	Tenant    string
+	Username  string
+	SessionID string
+}
+
+// Conn carries the opened messages of one stream
+type Conn interface {
+	// Recv returns the next message, or io.EOF once the client is done sending
+	Recv() ([]byte, error)
+	// Send seals and sends a message
+	Send([]byte) error
+}
+
+// Handler serves the messages of SecureExchange streams
+type Handler interface {
+	// ServeSecure handles one stream until it returns
+	ServeSecure(ctx context.Context, peer Peer, conn Conn) error
+}
+
+// Echo is a Handler that sends every message straight back, which lets
+// clients check the channel works
+type Echo struct{}
+
+// ServeSecure will echo messages until the client is done sending
+func (Echo) ServeSecure(ctx context.Context, peer Peer, conn Conn) error {
+	for {
+		msg, err := conn.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := conn.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Cipher seals or opens the messages of one direction of a stream, it
+// is not safe for concurrent use
+type Cipher struct {
+	aead    cipher.AEAD
+	counter uint64
+}
+
+// Derive returns the ciphers of a stream keyed by K, one for messages from
+// the client and one for messages from the server
+func Derive(key, clientRandom, serverRandom []byte) (client, server *Cipher, err error) {
+	if len(key) == 0 {
+		return nil, nil, ErrNotFound
+	}
+	if len(clientRandom) != RandomLength || len(serverRandom) != RandomLength {
+		return nil, nil, errors.New("randoms must be 32 bytes")
+	}
+
+	salt := make([]byte, 0, 2*RandomLength)
+	salt = append(append(salt, clientRandom...), serverRandom...)
+	client, err = newCipher(key, salt, clientInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err = newCipher(key, salt, serverInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, server, nil
+}
+
+// newCipher will derive the key of one direction and set up AES-GCM with it
+func newCipher(key, salt []byte, info string) (*Cipher, error) {
+	k := make([]byte, keyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(info)), k); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal will seal the next message and return it with its counter
+func (c *Cipher) Seal(plaintext []byte) (uint64, []byte, error) {
+	if c.counter == ^uint64(0) {
+		return 0, nil, ErrExhausted
+	}
+
+	n := c.counter
+	c.counter++
+
+	return n, c.aead.Seal(nil, c.nonce(n), plaintext, nil), nil
+}
+
+// Open will open the next message, which must carry the next counter
+func (c *Cipher) Open(counter uint64, ciphertext []byte) ([]byte, error) {
+	if counter != c.counter || c.counter == ^uint64(0) {
+		return nil, ErrReplay
+	}
+
+	plaintext, err := c.aead.Open(nil, c.nonce(counter), ciphertext, nil)
+	if err != nil {
+		return nil, ErrBadMessage
+	}
+	c.counter++
+
+	return plaintext, nil
+}
+
+// nonce is the counter, big endian, at the end of the GCM nonce
+func (c *Cipher) nonce(counter uint64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+
+	return nonce
+}
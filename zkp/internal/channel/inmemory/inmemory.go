@@ -0,0 +1,98 @@
+package inmemory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/channel"
+)
+
+// evictInterval is how often expired keys are dropped
+const evictInterval = time.Minute
+
+// entry is a session key and when it can be forgotten
+type entry struct {
+	key   []byte
+	until time.Time
+}
+
+// InMemory keeps session keys in memory and evicts them once their session has ended
+type InMemory struct {
+	mu   sync.Mutex
+	keys map[string]entry
+	done chan struct{}
+	once sync.Once
+}
+
+// Put will store a copy of the key until the given time
+func (im *InMemory) Put(sessionID string, key []byte, until time.Time) error {
+	im.mu.Lock()
+	im.keys[sessionID] = entry{
+		key:   append([]byte(nil), key...),
+		until: until,
+	}
+	im.mu.Unlock()
+
+	return nil
+}
+
+// Get will return a copy of the key of the session
+func (im *InMemory) Get(sessionID string) ([]byte, error) {
+	im.mu.Lock()
+	e, ok := im.keys[sessionID]
+	im.mu.Unlock()
+
+	if !ok || time.Now().After(e.until) {
+		return nil, channel.ErrNotFound
+	}
+
+	return append([]byte(nil), e.key...), nil
+}
+
+// Delete will forget the key of the session
+func (im *InMemory) Delete(sessionID string) error {
+	im.mu.Lock()
+	delete(im.keys, sessionID)
+	im.mu.Unlock()
+
+	return nil
+}
+
+// Close will stop evicting expired keys
+func (im *InMemory) Close() {
+	im.once.Do(func() {
+		close(im.done)
+	})
+}
+
+// evict removes expired keys until the store is closed
+func (im *InMemory) evict() {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-im.done:
+			return
+		case now := <-ticker.C:
+			im.mu.Lock()
+			for id, e := range im.keys {
+				if now.After(e.until) {
+					delete(im.keys, id)
+				}
+			}
+			im.mu.Unlock()
+		}
+	}
+}
+
+// New will create an in memory session key store
+func New() *InMemory {
+	im := &InMemory{
+		keys: make(map[string]entry),
+		done: make(chan struct{}),
+	}
+	go im.evict()
+
+	return im
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+	"github.com/imthaghost/goland/zkp/internal/ratelimit"
+	"github.com/imthaghost/goland/zkp/internal/token"
+)
+
+const (
+	DEV     = "dev"
+	STAGING = "staging"
+	PROD    = "prod"
+)
+
+// store backends
+const (
+	MEMORY = "memory"
+	BOLT   = "bolt"
+)
+
+// New will create a new config
+type New struct {
+	config Config
+}
+
+// Load will load the config from the environment
+func (n *New) Load() {
+	n.config = Config{
+		General:         getGeneralConfig(),
+		ServerConfig:    getServerConfig(),
+		GatewayConfig:   getGatewayConfig(),
+		StoreConfig:     getStoreConfig(),
+		PasswordConfig:  getPasswordConfig(),
+		HandshakeConfig: getHandshakeConfig(),
+		TOTPConfig:      getTOTPConfig(),
+		TokenConfig:     getTokenConfig(),
+		RateLimitConfig: getRateLimitConfig(),
+		AuditConfig:     getAuditConfig(),
+		MetricsConfig:   getMetricsConfig(),
+		AccessLogConfig: getAccessLogConfig(),
+		AdminConfig:     getAdminConfig(),
+	}
+}
+
+// Get will return the loaded config
+func (n *New) Get() Config {
+	return n.config
+}
+
+// getGeneralConfig returns the general config
+func getGeneralConfig() GeneralConfig {
+	// default
+	config := GeneralConfig{
+		AppEnv: os.Getenv("APP_ENV"),
+	}
+
+	if config.AppEnv == "" {
+		config.AppEnv = DEV
+	}
+
+	return config
+}
+
+// getServerConfig returns the server config
+func getServerConfig() ServerConfig {
+	// default
+	config := ServerConfig{
+		Addr:             os.Getenv("SERVER_ADDR"),
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:     os.Getenv("TLS_CLIENT_CA_FILE"),
+		KeepaliveTime:    getDuration("KEEPALIVE_TIME", 2*time.Hour),
+		KeepaliveTimeout: getDuration("KEEPALIVE_TIMEOUT", 20*time.Second),
+		KeepaliveMinTime: getDuration("KEEPALIVE_MIN_TIME", 5*time.Minute),
+		MaxRecvMsgSize:   getInt("MAX_RECV_MSG_SIZE", 64<<10),
+		MaxSendMsgSize:   getInt("MAX_SEND_MSG_SIZE", 64<<10),
+		ShutdownTimeout:  getDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+	}
+
+	if config.Addr == "" {
+		config.Addr = "localhost:8080"
+	}
+
+	return config
+}
+
+// getGatewayConfig returns the gateway config
+func getGatewayConfig() GatewayConfig {
+	// default
+	config := GatewayConfig{
+		Addr:         os.Getenv("GATEWAY_ADDR"),
+		TLSCertFile:  os.Getenv("GATEWAY_TLS_CERT_FILE"),
+		TLSKeyFile:   os.Getenv("GATEWAY_TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("GATEWAY_TLS_CLIENT_CA_FILE"),
+		CORSOrigins:  getList("GATEWAY_CORS_ORIGINS"),
+		CORSMaxAge:   getDuration("GATEWAY_CORS_MAX_AGE", 10*time.Minute),
+	}
+
+	return config
+}
+
+// getStoreConfig returns the store config
+func getStoreConfig() StoreConfig {
+	// default
+	config := StoreConfig{
+		Backend:       os.Getenv("STORE_BACKEND"),
+		Path:          os.Getenv("STORE_PATH"),
+		MasterKey:     os.Getenv("STORE_MASTER_KEY"),
+		MasterKeyFile: os.Getenv("STORE_MASTER_KEY_FILE"),
+	}
+
+	if config.Backend == "" {
+		config.Backend = MEMORY
+	}
+	if config.Path == "" {
+		config.Path = "zkp.db"
+	}
+
+	return config
+}
+
+// getPasswordConfig returns the password config
+func getPasswordConfig() PasswordConfig {
+	// default
+	policy := kdf.DefaultPolicy
+	if a := os.Getenv("KDF_ALGORITHM"); a != "" && a != policy.Algorithm {
+		policy = kdf.Params{Algorithm: a}
+		if a == kdf.PBKDF2 {
+			policy.Iterations = 600000
+		}
+	}
+
+	return PasswordConfig{
+		DefaultGroupBits: getInt("SRP_DEFAULT_GROUP_BITS", 3072),
+		MinGroupBits:     getInt("SRP_MIN_GROUP_BITS", 2048),
+		KDF: kdf.Params{
+			Algorithm:   policy.Algorithm,
+			Iterations:  uint32(getInt("KDF_ITERATIONS", int(policy.Iterations))),
+			Memory:      uint32(getInt("KDF_MEMORY", int(policy.Memory))),
+			Parallelism: uint32(getInt("KDF_PARALLELISM", int(policy.Parallelism))),
+		},
+	}
+}
+
+// getHandshakeConfig returns the handshake config
+func getHandshakeConfig() HandshakeConfig {
+	return HandshakeConfig{
+		TTL:         getDuration("HANDSHAKE_TTL", handshake.DefaultTTL),
+		DecoySecret: os.Getenv("DECOY_SECRET"),
+		DecoyFloor:  getDuration("DECOY_FLOOR", 50*time.Millisecond),
+	}
+}
+
+// getTOTPConfig returns the TOTP config
+func getTOTPConfig() TOTPConfig {
+	// default
+	config := TOTPConfig{
+		Issuer:       os.Getenv("TOTP_ISSUER"),
+		ChallengeTTL: getDuration("TOTP_CHALLENGE_TTL", 2*time.Minute),
+	}
+
+	if config.Issuer == "" {
+		config.Issuer = "zkp"
+	}
+
+	return config
+}
+
+// getTokenConfig returns the token config
+func getTokenConfig() TokenConfig {
+	// default
+	config := TokenConfig{
+		KeysDir:      os.Getenv("TOKEN_KEYS_DIR"),
+		SigningKeyID: os.Getenv("TOKEN_SIGNING_KEY_ID"),
+		Issuer:       os.Getenv("TOKEN_ISSUER"),
+		TTL:          getDuration("TOKEN_TTL", token.DefaultTTL),
+		RefreshTTL:   getDuration("TOKEN_REFRESH_TTL", token.DefaultRefreshTTL),
+	}
+
+	if config.Issuer == "" {
+		config.Issuer = "zkp"
+	}
+
+	return config
+}
+
+// getRateLimitConfig returns the rate limit config
+func getRateLimitConfig() RateLimitConfig {
+	d := ratelimit.DefaultConfig
+
+	return RateLimitConfig{
+		PeerRate:         getFloat("RATE_LIMIT_PEER_RATE", d.PeerRate),
+		PeerBurst:        getInt("RATE_LIMIT_PEER_BURST", d.PeerBurst),
+		UserRate:         getFloat("RATE_LIMIT_USER_RATE", d.UserRate),
+		UserBurst:        getInt("RATE_LIMIT_USER_BURST", d.UserBurst),
+		LockoutThreshold: getInt("LOCKOUT_THRESHOLD", d.LockoutThreshold),
+		LockoutBase:      getDuration("LOCKOUT_BASE", d.LockoutBase),
+		LockoutMax:       getDuration("LOCKOUT_MAX", d.LockoutMax),
+	}
+}
+
+// getAuditConfig returns the audit config
+func getAuditConfig() AuditConfig {
+	return AuditConfig{
+		File:         os.Getenv("AUDIT_LOG_FILE"),
+		SyncInterval: getDuration("AUDIT_LOG_SYNC_INTERVAL", time.Second),
+	}
+}
+
+// getMetricsConfig returns the metrics config
+func getMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		Addr: os.Getenv("METRICS_ADDR"),
+	}
+}
+
+// getAccessLogConfig returns the access log config
+func getAccessLogConfig() AccessLogConfig {
+	return AccessLogConfig{
+		Enabled: os.Getenv("ACCESS_LOG") != "off",
+		HashKey: os.Getenv("ACCESS_LOG_HASH_KEY"),
+	}
+}
+
+// getAdminConfig returns the admin config
+func getAdminConfig() AdminConfig {
+	return AdminConfig{
+		Users:       getList("ADMIN_USERS"),
+		ClientNames: getList("ADMIN_CLIENT_NAMES"),
+		Token:       os.Getenv("ADMIN_TOKEN"),
+	}
+}
+
+// getList reads a comma separated list from the environment
+func getList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// getDuration reads a duration such as "30s" from the environment, falling
+// back to def when it is unset or invalid
+func getDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s: %v", key, err)
+		return def
+	}
+
+	return d
+}
+
+// getInt reads an integer from the environment, falling back to def when it
+// is unset or invalid
+func getInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s: %v", key, err)
+		return def
+	}
+
+	return i
+}
+
+// getFloat reads a number from the environment, falling back to def when it
+// is unset or invalid
+func getFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("invalid %s: %v", key, err)
+		return def
+	}
+
+	return f
+}
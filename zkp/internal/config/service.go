@@ -0,0 +1,148 @@
+package config
+
+import (
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+)
+
+// Service is an interface that defines the functions needed to implement a Config Service.
+type Service interface {
+	// Load will do any config setup (like load env vars)
+	Load()
+	// Get will get the config
+	Get() Config
+}
+
+// Config is a service that is designed to provide various configuration to the rest of the application.
+type Config struct {
+	General GeneralConfig
+
+	ServerConfig    ServerConfig
+	GatewayConfig   GatewayConfig
+	StoreConfig     StoreConfig
+	PasswordConfig  PasswordConfig
+	HandshakeConfig HandshakeConfig
+	TOTPConfig      TOTPConfig
+	TokenConfig     TokenConfig
+	RateLimitConfig RateLimitConfig
+	AuditConfig     AuditConfig
+	MetricsConfig   MetricsConfig
+	AccessLogConfig AccessLogConfig
+	AdminConfig     AdminConfig
+}
+
+// GeneralConfig contains general information that the service needs to run.
+type GeneralConfig struct {
+	AppEnv string // the environment that the application is running in (dev, prod, etc)
+}
+
+// ServerConfig contains settings for the gRPC listener
+type ServerConfig struct {
+	Addr string // host:port to listen on
+
+	TLSCertFile  string // without a certificate we serve plaintext, which is only allowed in dev
+	TLSKeyFile   string
+	ClientCAFile string // when set, clients must present a certificate signed by this CA
+
+	KeepaliveTime    time.Duration // ping idle clients this often
+	KeepaliveTimeout time.Duration // and drop them if they do not answer within this
+	KeepaliveMinTime time.Duration // the most often clients may ping us
+
+	MaxRecvMsgSize int // bytes
+	MaxSendMsgSize int // bytes
+
+	ShutdownTimeout time.Duration // how long in-flight calls get to finish on shutdown
+}
+
+// GatewayConfig contains settings for the HTTP/JSON gateway. It has its own
+// TLS settings because browsers do not present client certificates.
+type GatewayConfig struct {
+	Addr string // host:port to listen on, the gateway is off when empty
+
+	TLSCertFile  string // the gRPC listener's certificate is used when empty
+	TLSKeyFile   string
+	ClientCAFile string // verifies client certificates when one is presented, never requires one
+
+	CORSOrigins []string      // browser origins allowed to call the gateway, "*" for any
+	CORSMaxAge  time.Duration // how long browsers may cache a preflight
+}
+
+// AuditConfig decides where audit events are written
+type AuditConfig struct {
+	File         string        // hash-chained JSON lines file, events are only streamed when empty
+	SyncInterval time.Duration // how often the file is synced to disk, 0 syncs every event
+}
+
+// MetricsConfig decides where Prometheus metrics are served
+type MetricsConfig struct {
+	Addr string // host:port serving /metrics over plain HTTP, off when empty
+}
+
+// AccessLogConfig decides how RPCs are logged
+type AccessLogConfig struct {
+	Enabled bool   // one JSON line per RPC on stdout
+	HashKey string // key usernames are hashed with, random on every start when empty
+}
+
+// AdminConfig decides who may call admin-only RPCs
+type AdminConfig struct {
+	Users       []string // usernames whose session tokens are accepted
+	ClientNames []string // common or DNS names of client certificates that are accepted
+	Token       string   // a bearer token that is accepted, for automation
+}
+
+// StoreConfig decides where users and verifiers are kept
+type StoreConfig struct {
+	Backend string // memory or bolt
+	Path    string // the database file for the bolt backend
+
+	// master keys sealing verifiers and salts at rest, hex or base64, comma or
+	// newline separated with the current one first, users are stored in the
+	// clear when neither is set
+	MasterKey     string
+	MasterKeyFile string
+}
+
+// PasswordConfig contains the SRP policy
+type PasswordConfig struct {
+	DefaultGroupBits int // the group clients should make new verifiers for
+	MinGroupBits     int // smaller groups are refused at registration
+
+	KDF kdf.Params // what new verifiers should be made with, weaker users enroll again on login
+}
+
+// HandshakeConfig contains settings for handshakes between Login and Validate
+type HandshakeConfig struct {
+	TTL         time.Duration // how long a client has between Login and Validate
+	DecoySecret string        // derives the salts we hand out for usernames that do not exist
+	DecoyFloor  time.Duration // how long Login takes at least, so unknown usernames are not answered quicker
+}
+
+// TOTPConfig contains settings for the TOTP second factor
+type TOTPConfig struct {
+	Issuer       string        // how we are named in authenticator apps
+	ChallengeTTL time.Duration // how long a user has to type in a code after the password
+}
+
+// TokenConfig contains settings for the session tokens we sign
+type TokenConfig struct {
+	KeysDir      string        // directory of ed25519 pem keys, named <kid>.pem
+	SigningKeyID string        // the key to sign with, defaults to the last key ID
+	Issuer       string        // the iss claim
+	TTL          time.Duration // how long a token is valid for
+	RefreshTTL   time.Duration // how long a session can be kept alive by refreshing
+}
+
+// RateLimitConfig contains the limits applied to Register, Login, Validate,
+// RefreshToken, ChangeVerifier and VerifyTOTP
+type RateLimitConfig struct {
+	PeerRate  float64 // requests per second from a single address
+	PeerBurst int
+	UserRate  float64 // requests per second naming a single username
+	UserBurst int
+
+	LockoutThreshold int           // bad proofs before an account is locked
+	LockoutBase      time.Duration // first lockout, doubled for every further bad proof
+	LockoutMax       time.Duration
+}
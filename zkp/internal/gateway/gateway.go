@@ -0,0 +1,265 @@
+// Package gateway is an HTTP/JSON front door to the Auth service for clients
+// that can not speak gRPC, such as browsers. Every route calls the same
+// handler, through the same interceptors, as the gRPC method it maps to.
+//
+// Bodies use the protobuf JSON mapping with the field names from the proto
+// file. Big integers (salt, verifier, A, B) and proofs are lowercase hex as
+// on the gRPC API, tokens are base64url and int64s are strings.
+//
+//	POST /v1/register      RegisterRequest      -> RegisterResponse
+//	POST /v1/login/start   LoginRequest         -> LoginResponse
+//	POST /v1/login/finish  ValidateRequest      -> ValidateResponse
+//	POST /v1/refresh       RefreshTokenRequest  -> RefreshTokenResponse
+//	POST /v1/logout        LogoutRequest        -> LogoutResponse
+//
+// Errors are a google.rpc.Status with the matching HTTP status code.
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxBodySize is the largest request body we read, a 4096 bit verifier in
+// hex is about 1KB
+const maxBodySize = 64 << 10
+
+// CORS decides which browser origins may call the gateway
+type CORS struct {
+	AllowedOrigins []string      // "*" allows every origin
+	MaxAge         time.Duration // how long browsers may cache a preflight
+}
+
+// route maps an HTTP path onto a gRPC method
+type route struct {
+	method     string
+	newRequest func() proto.Message
+	call       func(ctx context.Context, req proto.Message) (proto.Message, error)
+}
+
+// Gateway is an http.Handler that serves the routes
+type Gateway struct {
+	cors        CORS
+	interceptor grpc.UnaryServerInterceptor
+	routes      map[string]route
+}
+
+// New will create a new Gateway in front of auth. The interceptors should
+// be the ones the gRPC server runs, so limits apply to both the same way.
+func New(auth pb.AuthServer, cors CORS, interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	g := &Gateway{
+		cors:        cors,
+		interceptor: chain(interceptors),
+	}
+	g.routes = map[string]route{
+		"/v1/register": {
+			method:     "/auth.Auth/Register",
+			newRequest: func() proto.Message { return &pb.RegisterRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.Register(ctx, req.(*pb.RegisterRequest))
+			},
+		},
+		"/v1/login/start": {
+			method:     "/auth.Auth/Login",
+			newRequest: func() proto.Message { return &pb.LoginRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.Login(ctx, req.(*pb.LoginRequest))
+			},
+		},
+		"/v1/login/finish": {
+			method:     "/auth.Auth/Validate",
+			newRequest: func() proto.Message { return &pb.ValidateRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.Validate(ctx, req.(*pb.ValidateRequest))
+			},
+		},
+		"/v1/login/totp": {
+			method:     "/auth.Auth/VerifyTOTP",
+			newRequest: func() proto.Message { return &pb.VerifyTOTPRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.VerifyTOTP(ctx, req.(*pb.VerifyTOTPRequest))
+			},
+		},
+		"/v1/refresh": {
+			method:     "/auth.Auth/RefreshToken",
+			newRequest: func() proto.Message { return &pb.RefreshTokenRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.RefreshToken(ctx, req.(*pb.RefreshTokenRequest))
+			},
+		},
+		"/v1/logout": {
+			method:     "/auth.Auth/Logout",
+			newRequest: func() proto.Message { return &pb.LogoutRequest{} },
+			call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return auth.Logout(ctx, req.(*pb.LogoutRequest))
+			},
+		},
+	}
+
+	return g
+}
+
+// ServeHTTP will serve a single route
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed := g.setCORS(w, r)
+	if r.Method == http.MethodOptions {
+		// a preflight from an origin we do not know gets no CORS headers
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	rt, ok := g.routes[r.URL.Path]
+	if !ok {
+		writeError(w, status.New(codes.NotFound, "no such route"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed").Proto())
+		return
+	}
+
+	req := rt.newRequest()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, status.New(codes.InvalidArgument, "could not read body"))
+		return
+	}
+	if len(body) > 0 {
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req); err != nil {
+			writeError(w, status.New(codes.InvalidArgument, "malformed JSON body"))
+			return
+		}
+	}
+
+	stream := &transportStream{method: rt.method}
+	ctx := grpc.NewContextWithServerTransportStream(incomingContext(r), stream)
+	info := &grpc.UnaryServerInfo{FullMethod: rt.method}
+	resp, err := g.interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return rt.call(ctx, req.(proto.Message))
+	})
+
+	if v := stream.header.Get("retry-after"); len(v) > 0 {
+		w.Header().Set("Retry-After", v[0])
+	}
+	if v := stream.header.Get("x-request-id"); len(v) > 0 {
+		w.Header().Set("X-Request-Id", v[0])
+	}
+	if err != nil {
+		writeError(w, status.Convert(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp.(proto.Message))
+}
+
+// setCORS will set the CORS headers when the origin is allowed
+func (g *Gateway) setCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !g.allowed(origin) {
+		return false
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Expose-Headers", "Retry-After, X-Request-Id")
+	if r.Method == http.MethodOptions {
+		h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-Id, X-Tenant-Id")
+		if g.cors.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(g.cors.MaxAge.Seconds())))
+		}
+	}
+
+	return true
+}
+
+// allowed reports whether origin may call us
+func (g *Gateway) allowed(origin string) bool {
+	for _, o := range g.cors.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// incomingContext makes the request look like an incoming gRPC call to the
+// handlers and interceptors, with the caller as peer and the headers they
+// read as metadata
+func incomingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, k := range []string{"Authorization", "X-Request-Id", "X-Tenant-Id"} {
+		if v := r.Header.Values(k); len(v) > 0 {
+			md.Set(strings.ToLower(k), v...)
+		}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	return peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(r.RemoteAddr)})
+}
+
+// remoteAddr is the address of an HTTP client as a net.Addr
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
+
+var _ net.Addr = remoteAddr("")
+
+// transportStream collects the headers handlers set with grpc.SetHeader
+type transportStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *transportStream) Method() string { return s.method }
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+// chain will run the interceptors in order, the first one outermost
+func chain(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			ic, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return ic(ctx, req, info, h)
+			}
+		}
+
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// auth fails Login with the code named by the username, or starts one
+type auth struct {
+	pb.UnimplementedAuthServer
+}
+
+func (auth) Login(ctx context.Context, request *pb.LoginRequest) (*pb.LoginResponse, error) {
+	for c := codes.OK + 1; c <= codes.Unauthenticated; c++ {
+		if request.Username != strings.ToLower(c.String()) {
+			continue
+		}
+		if c == codes.ResourceExhausted {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", "30"))
+		}
+		return nil, status.Error(c, "failed")
+	}
+
+	return &pb.LoginResponse{HandshakeId: "handshake"}, nil
+}
+
+// newGateway returns a gateway in front of the auth stub that lets
+// https://app.example.com call it
+func newGateway() *Gateway {
+	return New(auth{}, CORS{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: 10 * time.Minute})
+}
+
+// login posts a Login for username to the gateway
+func login(g *Gateway, username string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/v1/login/start", strings.NewReader(`{"username":"`+username+`"}`))
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		code   int
+		// allowed is whether the browser gets to see the response
+		allowed bool
+	}{
+		{"allowed origin", http.MethodPost, "https://app.example.com", http.StatusOK, true},
+		{"allowed origin in another case", http.MethodPost, "https://APP.example.com", http.StatusOK, true},
+		{"disallowed origin", http.MethodPost, "https://evil.example.com", http.StatusOK, false},
+		{"no origin", http.MethodPost, "", http.StatusOK, false},
+		{"preflight", http.MethodOptions, "https://app.example.com", http.StatusNoContent, true},
+		{"preflight of a disallowed origin", http.MethodOptions, "https://evil.example.com", http.StatusForbidden, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/login/start", strings.NewReader(`{"username":"alice"}`))
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			newGateway().ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if !tt.allowed && got != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q for an origin that is not allowed", got)
+			}
+
+			preflight := tt.method == http.MethodOptions && tt.allowed
+			if methods := w.Header().Get("Access-Control-Allow-Methods"); (methods != "") != preflight {
+				t.Errorf("Access-Control-Allow-Methods = %q, want it on allowed preflights only", methods)
+			}
+			if preflight && w.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.Unimplemented, http.StatusNotImplemented},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			w := login(newGateway(), strings.ToLower(tt.code.String()))
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			var st spb.Status
+			if err := protojson.Unmarshal(w.Body.Bytes(), &st); err != nil {
+				t.Fatalf("body %s is not a google.rpc.Status: %v", w.Body, err)
+			}
+			if codes.Code(st.Code) != tt.code {
+				t.Errorf("body code = %v, want %v", codes.Code(st.Code), tt.code)
+			}
+			if retry := w.Header().Get("Retry-After"); (retry != "") != (tt.code == codes.ResourceExhausted) {
+				t.Errorf("Retry-After = %q, want it only when rate limited", retry)
+			}
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"login", http.MethodPost, "/v1/login/start", `{"username":"alice"}`, http.StatusOK},
+		{"unknown route", http.MethodPost, "/v1/nope", `{}`, http.StatusNotFound},
+		{"not a POST", http.MethodGet, "/v1/login/start", "", http.StatusMethodNotAllowed},
+		{"malformed body", http.MethodPost, "/v1/login/start", `{"username":`, http.StatusBadRequest},
+		{"body too large", http.MethodPost, "/v1/login/start", `{"username":"` + strings.Repeat("a", maxBodySize) + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newGateway().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package handshake
+
+import (
+	"errors"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/password"
+)
+
+// DefaultTTL is how long a client has between Login and Validate
+const DefaultTTL = 30 * time.Second
+
+// ErrNotFound is returned when a handshake does not exist, has expired or was already used
+var ErrNotFound = errors.New("handshake not found")
+
+// Session is the server state of an SRP exchange kept between Login and Validate
+type Session struct {
+	ID       string
+	Tenant   string
+	Username string
+	Salt     string
+	// Server holds our ephemeral secret b and knows the proof we expect
+	Server password.Session
+	// Upgrade is set when the user's KDF is weaker than the policy, so a
+	// successful Validate asks the client to enroll again
+	Upgrade bool
+	// SecondFactor is set when the user enrolled one, a good proof then
+	// only earns a challenge for it
+	SecondFactor bool
+	// Locked is set when an admin locked the account, a good proof then
+	// earns nothing
+	Locked bool
+	// ResetRequired is set when an admin forced a password reset, a good
+	// proof then only earns a token to change the password with
+	ResetRequired bool
+	// SessionID is, for a second factor challenge, the ID of the handshake
+	// whose proof it follows, which the session keeps as its ID
+	SessionID string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Service describes how we keep handshakes between Login and Validate
+type Service interface {
+	// Create stores the session under a new opaque ID and returns it
+	Create(*Session) (string, error)
+	// Take returns the session with the given ID and removes it so it can
+	// never be validated twice
+	Take(id string) (*Session, error)
+}
@@ -0,0 +1,95 @@
+package inmemory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+)
+
+// InMemory keeps pending handshakes in memory and evicts them once they expire
+type InMemory struct {
+	TTL time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*handshake.Session
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Create will store the session under a new random ID
+func (im *InMemory) Create(s *handshake.Session) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s.ID = hex.EncodeToString(b)
+	s.CreatedAt = time.Now()
+	s.ExpiresAt = s.CreatedAt.Add(im.TTL)
+
+	im.mu.Lock()
+	im.sessions[s.ID] = s
+	im.mu.Unlock()
+
+	return s.ID, nil
+}
+
+// Take will return the session and remove it from the store
+func (im *InMemory) Take(id string) (*handshake.Session, error) {
+	im.mu.Lock()
+	s, ok := im.sessions[id]
+	delete(im.sessions, id)
+	im.mu.Unlock()
+
+	if !ok || time.Now().After(s.ExpiresAt) {
+		return nil, handshake.ErrNotFound
+	}
+
+	return s, nil
+}
+
+// Close will stop evicting expired sessions
+func (im *InMemory) Close() {
+	im.once.Do(func() {
+		close(im.done)
+	})
+}
+
+// evict removes expired sessions until the store is closed
+func (im *InMemory) evict() {
+	ticker := time.NewTicker(im.TTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-im.done:
+			return
+		case now := <-ticker.C:
+			im.mu.Lock()
+			for id, s := range im.sessions {
+				if now.After(s.ExpiresAt) {
+					delete(im.sessions, id)
+				}
+			}
+			im.mu.Unlock()
+		}
+	}
+}
+
+// New will create an in memory handshake store whose sessions live for ttl
+func New(ttl time.Duration) *InMemory {
+	if ttl <= 0 {
+		ttl = handshake.DefaultTTL
+	}
+
+	im := &InMemory{
+		TTL:      ttl,
+		sessions: make(map[string]*handshake.Session),
+		done:     make(chan struct{}),
+	}
+	go im.evict()
+
+	return im
+}
@@ -0,0 +1,107 @@
+package inmemory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/handshake"
+)
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  []error // of each Take in turn
+		sleep time.Duration
+	}{
+		{
+			name: "once",
+			want: []error{nil},
+		},
+		{
+			// a proof must never be checked twice against the same b
+			name: "twice",
+			want: []error{nil, handshake.ErrNotFound},
+		},
+		{
+			name:  "after it expired",
+			sleep: 20 * time.Millisecond,
+			want:  []error{handshake.ErrNotFound},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := New(10 * time.Millisecond)
+			defer im.Close()
+
+			// the evictor would hide whether Take checks expiry itself
+			im.Close()
+
+			id, err := im.Create(&handshake.Session{Username: "alice"})
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			time.Sleep(tt.sleep)
+
+			for i, want := range tt.want {
+				s, err := im.Take(id)
+				if err != want {
+					t.Fatalf("Take() %d error = %v, want %v", i, err, want)
+				}
+				if err == nil && (s.ID != id || s.Username != "alice") {
+					t.Errorf("Take() %d = %+v, want alice under %s", i, s, id)
+				}
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	im := New(0)
+	defer im.Close()
+
+	if im.TTL != handshake.DefaultTTL {
+		t.Errorf("TTL = %v, want %v", im.TTL, handshake.DefaultTTL)
+	}
+
+	s := &handshake.Session{Username: "alice"}
+	before := time.Now()
+	id, err := im.Create(s)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if s.ExpiresAt.Before(before.Add(handshake.DefaultTTL)) || s.ExpiresAt.After(time.Now().Add(handshake.DefaultTTL)) {
+		t.Errorf("session expires at %v, want %v after it was created", s.ExpiresAt, handshake.DefaultTTL)
+	}
+
+	other, err := im.Create(&handshake.Session{Username: "alice"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if id == other {
+		t.Error("Create() gave two sessions the same ID")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	im := New(5 * time.Millisecond)
+	defer im.Close()
+
+	if _, err := im.Create(&handshake.Session{Username: "alice"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		im.mu.Lock()
+		n := len(im.sessions)
+		im.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d expired sessions still held", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,133 @@
+// Package health drives the standard grpc.health.v1 service from probes of
+// the things each service depends on.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// defaults for a new Checker
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = 2 * time.Second
+)
+
+// Probe checks a single dependency, a nil error means it is usable
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Checker runs the probes and keeps the serving status of every service up
+// to date. The empty service name stands for the server as a whole and is
+// only serving while every other service is.
+type Checker struct {
+	*health.Server
+
+	Interval time.Duration
+	Timeout  time.Duration
+
+	mu       sync.Mutex
+	services map[string][]Probe
+	failures map[string]error
+}
+
+// New will create a new Checker, every service starts out not serving
+// until the first round of probes has passed
+func New() *Checker {
+	c := &Checker{
+		Server:   health.NewServer(),
+		Interval: DefaultInterval,
+		Timeout:  DefaultTimeout,
+		services: make(map[string][]Probe),
+		failures: make(map[string]error),
+	}
+	c.Server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return c
+}
+
+// AddService will register a service that is serving while all its probes pass
+func (c *Checker) AddService(service string, probes ...Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.services[service] = probes
+	c.Server.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Failures returns the probes that failed in the last round by name
+func (c *Checker) Failures() map[string]error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := make(map[string]error, len(c.failures))
+	for name, err := range c.failures {
+		failures[name] = err
+	}
+
+	return failures
+}
+
+// Run will probe every Interval until ctx is done, then mark every service
+// as not serving so load balancers stop sending calls during shutdown
+func (c *Checker) Run(ctx context.Context) {
+	t := time.NewTicker(c.Interval)
+	defer t.Stop()
+
+	for {
+		c.Probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			c.Server.Shutdown()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Probe will run every probe once and update the serving status
+func (c *Checker) Probe(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// services can share probes, only run each one once per round
+	results := make(map[string]error)
+	for _, probes := range c.services {
+		for _, p := range probes {
+			if _, ok := results[p.Name]; ok {
+				continue
+			}
+			pctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			results[p.Name] = p.Check(pctx)
+			cancel()
+		}
+	}
+
+	c.failures = make(map[string]error)
+	for name, err := range results {
+		if err != nil {
+			c.failures[name] = err
+		}
+	}
+
+	all := healthpb.HealthCheckResponse_SERVING
+	for service, probes := range c.services {
+		st := healthpb.HealthCheckResponse_SERVING
+		for _, p := range probes {
+			if results[p.Name] != nil {
+				st = healthpb.HealthCheckResponse_NOT_SERVING
+				all = st
+				break
+			}
+		}
+		c.Server.SetServingStatus(service, st)
+	}
+	c.Server.SetServingStatus("", all)
+}
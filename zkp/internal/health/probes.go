@@ -0,0 +1,34 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/token"
+)
+
+// StoreProbe checks that the store can be used
+func StoreProbe(ss store.Service) Probe {
+	return Probe{
+		Name: "store",
+		Check: func(ctx context.Context) error {
+			return ss.Ping()
+		},
+	}
+}
+
+// KeystoreProbe checks that the current signing key works and is published,
+// it never mints a token
+func KeystoreProbe(ts token.Service) Probe {
+	return Probe{
+		Name: "keystore",
+		Check: func(ctx context.Context) error {
+			if len(ts.PublicKeys()) == 0 {
+				return errors.New("no verification keys")
+			}
+
+			return ts.Check()
+		},
+	}
+}
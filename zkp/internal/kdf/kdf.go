@@ -0,0 +1,150 @@
+// Package kdf describes how a client turns a password into the SRP private
+// key x. The server never runs a KDF, it only records which one each user
+// enrolled with, checks the parameters are sane and compares them against
+// the current policy.
+//
+// For every algorithm but RFC5054 the client computes
+//
+//	x = KDF(username ":" password, salt) as a 32 byte big-endian integer
+package kdf
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/1Password/srp"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// algorithms
+const (
+	// RFC5054 is x = H(s | H(I | ":" | P)), what users enrolled with before
+	// the KDF was recorded. It is cheap to brute force.
+	RFC5054  = "rfc5054"
+	Argon2id = "argon2id"
+	PBKDF2   = "pbkdf2-sha256"
+)
+
+// limits on the parameters we accept, the upper ones keep a bad policy or a
+// malicious registration from making every login impossibly slow
+const (
+	MinArgon2Time   = 1
+	MaxArgon2Time   = 16
+	MinArgon2Memory = 8 << 10 // KiB
+	MaxArgon2Memory = 4 << 20 // KiB
+	MaxArgon2Lanes  = 64
+	MinPBKDF2Iter   = 100000
+	MaxPBKDF2Iter   = 10000000
+)
+
+// keyLength is the size of x in bytes for every algorithm but RFC5054
+const keyLength = 32
+
+// ErrInvalid is returned for parameters we do not accept
+var ErrInvalid = errors.New("invalid kdf parameters")
+
+// Params are the algorithm and its cost parameters
+type Params struct {
+	Algorithm string `json:"algorithm,omitempty"`
+	// Iterations is the Argon2id time cost or the PBKDF2 iteration count
+	Iterations uint32 `json:"iterations,omitempty"`
+	// Memory is the Argon2id memory cost in KiB
+	Memory uint32 `json:"memory,omitempty"`
+	// Parallelism is the number of Argon2id lanes
+	Parallelism uint32 `json:"parallelism,omitempty"`
+}
+
+// DefaultPolicy is the policy when none is configured, the second
+// recommended option of RFC 9106 with fewer lanes for browsers
+var DefaultPolicy = Params{
+	Algorithm:   Argon2id,
+	Iterations:  3,
+	Memory:      64 << 10,
+	Parallelism: 4,
+}
+
+// Normalize returns p with an empty algorithm read as RFC5054, which is
+// what users stored before the KDF was recorded have
+func (p Params) Normalize() Params {
+	if p.Algorithm == "" {
+		return Params{Algorithm: RFC5054}
+	}
+
+	return p
+}
+
+// Validate checks that p is an algorithm we know with sane parameters
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case RFC5054:
+		if p.Iterations != 0 || p.Memory != 0 || p.Parallelism != 0 {
+			return fmt.Errorf("%w: %s takes no parameters", ErrInvalid, RFC5054)
+		}
+	case Argon2id:
+		if p.Iterations < MinArgon2Time || p.Iterations > MaxArgon2Time {
+			return fmt.Errorf("%w: argon2id time must be between %d and %d", ErrInvalid, MinArgon2Time, MaxArgon2Time)
+		}
+		if p.Memory < MinArgon2Memory || p.Memory > MaxArgon2Memory {
+			return fmt.Errorf("%w: argon2id memory must be between %d and %d KiB", ErrInvalid, MinArgon2Memory, MaxArgon2Memory)
+		}
+		if p.Parallelism < 1 || p.Parallelism > MaxArgon2Lanes {
+			return fmt.Errorf("%w: argon2id parallelism must be between 1 and %d", ErrInvalid, MaxArgon2Lanes)
+		}
+	case PBKDF2:
+		if p.Iterations < MinPBKDF2Iter || p.Iterations > MaxPBKDF2Iter {
+			return fmt.Errorf("%w: pbkdf2 iterations must be between %d and %d", ErrInvalid, MinPBKDF2Iter, MaxPBKDF2Iter)
+		}
+		if p.Memory != 0 || p.Parallelism != 0 {
+			return fmt.Errorf("%w: pbkdf2 takes only iterations", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown algorithm %q", ErrInvalid, p.Algorithm)
+	}
+
+	return nil
+}
+
+// Weaker reports whether p falls short of the policy. A different algorithm
+// always does, the policy names the one we want everybody on.
+func (p Params) Weaker(policy Params) bool {
+	p = p.Normalize()
+	if p.Algorithm != policy.Algorithm {
+		return true
+	}
+
+	switch p.Algorithm {
+	case Argon2id:
+		// lanes change how the work is split, not how much there is
+		return p.Iterations < policy.Iterations || p.Memory < policy.Memory
+	case PBKDF2:
+		return p.Iterations < policy.Iterations
+	}
+
+	return false
+}
+
+// Derive will turn the password into the SRP private key x. It refuses
+// parameters that do not Validate, a hostile server could otherwise make a
+// client burn all its memory or CPU.
+func (p Params) Derive(salt []byte, username, password string) (*big.Int, error) {
+	p = p.Normalize()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	secret := []byte(username + ":" + password)
+	switch p.Algorithm {
+	case Argon2id:
+		key := argon2.IDKey(secret, salt, p.Iterations, p.Memory, uint8(p.Parallelism), keyLength)
+		return new(big.Int).SetBytes(key), nil
+	case PBKDF2:
+		key := pbkdf2.Key(secret, salt, int(p.Iterations), keyLength, sha256.New)
+		return new(big.Int).SetBytes(key), nil
+	}
+
+	return srp.KDFRFC5054(salt, username, password), nil
+}
@@ -0,0 +1,80 @@
+package kdf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/1Password/srp"
+)
+
+func TestDerive(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr error
+	}{
+		{name: "empty is rfc5054", params: Params{}},
+		{name: "rfc5054", params: Params{Algorithm: RFC5054}},
+		{name: "argon2id", params: Params{Algorithm: Argon2id, Iterations: 1, Memory: MinArgon2Memory, Parallelism: 1}},
+		{name: "pbkdf2", params: Params{Algorithm: PBKDF2, Iterations: MinPBKDF2Iter}},
+		{
+			// a hostile server must not get us to allocate this much
+			name:    "argon2id memory above the limit",
+			params:  Params{Algorithm: Argon2id, Iterations: 1, Memory: MaxArgon2Memory + 1, Parallelism: 1},
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "argon2id without lanes",
+			params:  Params{Algorithm: Argon2id, Iterations: 1, Memory: MinArgon2Memory},
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "pbkdf2 iterations above the limit",
+			params:  Params{Algorithm: PBKDF2, Iterations: MaxPBKDF2Iter + 1},
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "unknown algorithm",
+			params:  Params{Algorithm: "md5"},
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := tt.params.Derive(salt, "alice", "password")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Derive() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			again, err := tt.params.Derive(salt, "alice", "password")
+			if err != nil {
+				t.Fatalf("Derive() error = %v", err)
+			}
+			if x.Cmp(again) != 0 {
+				t.Error("Derive() is not deterministic")
+			}
+			other, err := tt.params.Derive(salt, "alice", "Password")
+			if err != nil {
+				t.Fatalf("Derive() error = %v", err)
+			}
+			if x.Cmp(other) == 0 {
+				t.Error("Derive() gave two passwords the same x")
+			}
+		})
+	}
+
+	// users enrolled before the KDF was recorded must still log in
+	x, err := Params{}.Derive(salt, "alice", "password")
+	if err != nil {
+		t.Fatalf("Derive() error = %v", err)
+	}
+	if want := srp.KDFRFC5054(salt, "alice", "password"); x.Cmp(want) != 0 {
+		t.Errorf("Derive() = %x, want %x", x, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Package metrics exposes Prometheus metrics for the gRPC server, recorded
+// by interceptors so handlers do not need to know about them.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LoginMethods are the RPCs that finish a login, their outcome is counted
+// as a login success or failure
+var LoginMethods = []string{
+	"/auth.Auth/Validate",
+	"/auth.Auth/VerifyTOTP",
+}
+
+// pendingResponse is a response to a login that is not finished yet
+type pendingResponse interface {
+	GetSecondFactorRequired() bool
+}
+
+// Metrics holds every collector along with the registry they are served from
+type Metrics struct {
+	registry *prometheus.Registry
+	handled  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	logins   *prometheus.CounterVec
+	login    map[string]bool
+}
+
+// New will create a new Metrics with its own registry, which also carries
+// the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "zkp",
+			Subsystem: "grpc",
+			Name:      "handled_total",
+			Help:      "RPCs completed on the server, by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "zkp",
+			Subsystem: "grpc",
+			Name:      "handling_seconds",
+			Help:      "Time taken to handle RPCs, by method.",
+			// key derivation and SRP in big groups are slow on purpose
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"method"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "zkp",
+			Name:      "logins_total",
+			Help:      "Finished logins, by result.",
+		}, []string{"result"}),
+		login: make(map[string]bool, len(LoginMethods)),
+	}
+	for _, method := range LoginMethods {
+		m.login[method] = true
+	}
+
+	m.registry.MustRegister(
+		m.handled,
+		m.latency,
+		m.logins,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler will serve the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// UnaryServerInterceptor records latency, status codes and logins of unary RPCs
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, start, err)
+		if p, ok := resp.(pendingResponse); ok && p.GetSecondFactorRequired() {
+			return resp, err
+		}
+		m.countLogin(info.FullMethod, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records latency and status codes of streaming
+// RPCs, the latency being how long the stream was open
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, start, err)
+		m.countLogin(info.FullMethod, err)
+
+		return err
+	}
+}
+
+// observe will record a single finished RPC
+func (m *Metrics) observe(method string, start time.Time, err error) {
+	m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	m.handled.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// countLogin will count the outcome of an RPC that finishes a login
+func (m *Metrics) countLogin(method string, err error) {
+	if !m.login[method] {
+		return
+	}
+	switch status.Code(err) {
+	case codes.OK:
+		m.logins.WithLabelValues("success").Inc()
+	case codes.Unauthenticated:
+		m.logins.WithLabelValues("failure").Inc()
+	}
+}
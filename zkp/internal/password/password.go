@@ -1,5 +1,61 @@
 package password
 
-// Service describes an interface with srp
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// ErrBadProof is returned when the client proof does not match the one we expect
+	ErrBadProof = errors.New("bad proof from client")
+	// ErrBadPublic is returned when the client sends a malicious ephemeral public key
+	ErrBadPublic = errors.New("invalid public ephemeral key")
+	// ErrBadVerifier is returned when a verifier is not a valid member of the group
+	ErrBadVerifier = errors.New("invalid verifier")
+	// ErrUnknownGroup is returned for a group we do not support
+	ErrUnknownGroup = errors.New("unsupported srp group")
+	// ErrWeakGroup is returned for a group smaller than the policy allows
+	ErrWeakGroup = errors.New("srp group is smaller than allowed")
+)
+
+// Service describes an interface with srp. It knows every group it can
+// run sessions in, and which of those new verifiers may be made for.
 type Service interface {
+	// Group returns the group with the given id or ErrUnknownGroup
+	Group(id string) (Group, error)
+	// DefaultGroup returns the group new verifiers should be made for
+	DefaultGroup() Group
+	// Groups returns the groups new verifiers may be made for, smallest first
+	Groups() []Group
+	// MinBits returns the smallest group size new verifiers may be made for
+	MinBits() int
+}
+
+// Group is a single Diffie-Hellman group
+type Group interface {
+	// ID returns the id of the group, which is what clients send and we store
+	ID() string
+	// Bits returns the size of the prime
+	Bits() int
+	// Prime returns N
+	Prime() *big.Int
+	// Generator returns g
+	Generator() *big.Int
+	// ValidateVerifier checks that a verifier sent by the client at registration
+	// is safe to store
+	ValidateVerifier(verifier *big.Int) error
+	// NewSession starts the server side of an authentication session
+	NewSession(username string, salt []byte, verifier, A *big.Int) (Session, error)
+	// Verifier computes the verifier for the private key x
+	Verifier(x *big.Int) (*big.Int, error)
+}
+
+// Session is the server side of a single authentication session
+type Session interface {
+	// EphemeralPublic returns B which needs to be sent to the client
+	EphemeralPublic() *big.Int
+	// Verify checks the client proof M1 and returns the server proof M2
+	Verify(clientProof []byte) ([]byte, error)
+	// Key returns the shared session key K
+	Key() ([]byte, error)
 }
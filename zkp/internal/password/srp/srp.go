@@ -1,217 +1,243 @@
 package srp
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/imthaghost/goland/zkp/internal/password"
+
 	"github.com/1Password/srp"
 )
 
-// SRP ...
+// RFC 5054 groups we are willing to use
+const (
+	RFC5054Group2048 = srp.RFC5054Group2048
+	RFC5054Group3072 = srp.RFC5054Group3072
+	RFC5054Group4096 = srp.RFC5054Group4096
+)
+
+// SupportedGroups are the groups sessions can run in
+var SupportedGroups = []int{RFC5054Group2048, RFC5054Group3072, RFC5054Group4096}
+
+// GroupForBits will return the supported group with a prime of the given size
+func GroupForBits(bits int) (int, error) {
+	for _, id := range SupportedGroups {
+		if srp.KnownGroups[id].N().BitLen() == bits {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no supported srp group of %d bits", bits)
+}
+
+// LegacyGroupID is the group every session ran in before group IDs were
+// checked, users stored with an unknown group ID are assumed to use it
+const LegacyGroupID = "5054A3072"
+
+// SRP holds every group we can run sessions in
 type SRP struct {
-	Group srp.Group
-}
-
-// Example ....
-func Example() {
-	//// This example has both a server and the corresponding client live
-	//// in the same function. That is not something you would normally do.
-	//// Normally, you would be running one side (client or server) only.
-	//// If I understand channels better, I could probably set up a more
-	//// realistic example.
-	//
-	//var err error
-	//var A, B *big.Int
-	//
-	///*** Part 1: First encounter. Enrollment ***/
-	//
-	//// On first encounter between client and server, they will negotiate
-	//// an SRP group to use. We will assume that they have settled on
-	//// RFC5054Group3072
-	//
-	//group := srp.RFC5054Group3072
-	//
-	//// The client will need a password from the user and will also need
-	//// a salt.
-	//
-	//pw := "Fido1961!" // It's the "!" that makes this password super secure
-	//
-	//// Generate 8 bytes of random salt. Be sure to use crypto/rand for all
-	//// of your random number needs
-	//salt := make([]byte, 8)
-	//if n, err := rand.Read(salt); err != nil {
-	//	log.Fatal(err)
-	//} else if n != 8 {
-	//	log.Fatal("failed to generate 8 byte salt")
-	//}
-	//
-	//username := "fred@fred.example"
-	//
-	//// You would use a better Key Derivation Function than this one
-	//x := srp.KDFRFC5054(salt, username, pw) // Really. Don't use this KDF
-	//
-	//// this is still our first use scenario, but the client needs to create
-	//// an SRP client to generate the verifier.
-	//firstClient := srp.NewSRPClient(srp.KnownGroups[group], x)
-	//
-	//if firstClient == nil {
-	//	log.Fatal("couldn't setup client")
-	//}
-	//v, err := firstClient.Verifier()
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-	//
-	//// Now the client has all it needs to enroll with the server.
-	//// Client sends salt, username, and v to the server
-	//
-	//// Server will store long term the salt, username, an identifier for the SRP group
-	//// used and v. It should store v securely.
-	//
-	///*** Part 2: An authentication session ***/
-	//
-	//// Some time later, we actually want to authenticate with this stuff
-	//// Client and server may talk. Depending on what the client has locally,
-	//// The client may need to be told its salt, and the SRP group to use
-	//// But here we will assume that that the client knows this, and already has
-	//// computed x.
-	//
-	//client := srp.NewClientStd(srp.KnownGroups[group], x)
-	//
-	//// The client will need to send its ephemeral public key to the server
-	//// so we fetch that now.
-	//A = client.EphemeralPublic()
-	//
-	//// Now it is time for some stuff (though not much) on the server.
-	//server := srp.NewServerStd(srp.KnownGroups[group], v)
-	//if server == nil {
-	//	log.Fatal("Couldn't set up server")
-	//}
-	//
-	//// The server will get A (clients ephemeral public key) from the client
-	//// which the server will set using SetOthersPublic
-	//
-	//// Server MUST check error status here as defense against
-	//// a malicious A sent by client.
-	//if err = server.SetOthersPublic(A); err != nil {
-	//	log.Fatal(err)
-	//}
-	//
-	//// server sends its ephemeral public key, B, to client
-	//// client sets it as others public key.
-	//if B = server.EphemeralPublic(); B == nil {
-	//	log.Fatal("server couldn't make B")
-	//}
-	//
-	//// server can now make the key.
-	//serverKey, err := server.Key()
-	//if err != nil || serverKey == nil {
-	//	log.Fatalf("something went wrong making server key: %s\n", err)
-	//}
-	//
-	//// Once the client receives B from the server it can set it.
-	//// Client should check error status here as defense against
-	//// a malicious B sent from server
-	//if err = client.SetOthersPublic(B); err != nil {
-	//	log.Fatal(err)
-	//}
-	//
-	//// client can now make the session key
-	//clientKey, err := client.Key()
-	//if err != nil || clientKey == nil {
-	//	log.Fatalf("something went wrong making server key: %s", err)
-	//}
-	//
-	///*** Part 3: Server and client prove they have the same key ***/
-	//
-	//// Server computes a proof, and sends it to the client
-	//
-	//serverProof, err := server.M(salt, username)
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-	//
-	//// client tests tests that the server sent a good proof
-	//if !client.GoodServerProof(salt, username, serverProof) {
-	//	// Client must bail and not send a its own proof back to the server
-	//	log.Fatal("bad proof from server")
-	//}
-	//
-	//// Only after having a valid server proof will the client construct its own
-	//clientProof, err := client.ClientProof()
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-	//
-	//// client sends its proof to the server. Server checks
-	//if !server.GoodClientProof(clientProof) {
-	//	log.Fatal("bad proof from client")
-	//}
-	//
-	///*** Part 4: Server and Client exchange secret messages ***/
-	//
-	//// Once you have confirmed that client and server are using the same key
-	//// (thus proving that x and v have the right relation to each other)
-	//// we can use that key to encrypt stuff.
-	//
-	//// Let's have it be a missive from the server to the client
-	//
-	//// server sets up a block cipher with the key
-	//serverBlock, _ := aes.NewCipher(serverKey) // set with server's key
-	//serverCryptor, _ := cipher.NewGCM(serverBlock)
-	//
-	//// The client can set up its own cryptor. Note that it uses
-	//// the key that it (the client) got from SRP
-	//clientBlock, _ := aes.NewCipher(clientKey) // with the Client's key
-	//clientCryptor, _ := cipher.NewGCM(clientBlock)
-	//
-	//// We will use GCM with a 12 byte nonce for this example
-	//// NEVER use the same nonce twice with the same key. Never.
-	//nonce := make([]byte, 12)
-	//if n, err := rand.Read(nonce); err != nil {
-	//	log.Fatal(err)
-	//} else if n != 12 {
-	//	log.Fatal("failed to generate 12 byte nonce")
-	//}
-	//
-	//plaintext := []byte("Hi client! Will you be my Valentine?")
-	//ciphertext := serverCryptor.Seal(nil, nonce, plaintext, nil)
-	//// You can use the same serverCryptor many times within a session,
-	//// (up to about 2^32) for different encryptions
-	//// but you MUST use a new nonce for each encryption.
-	//
-	//// Server sends the the ciphertext and the nonce to the client
-	//
-	//message, err := clientCryptor.Open(nil, nonce, ciphertext, nil)
-	//if err != nil {
-	//	// if decryption fails, do not trust anything about ciphertext
-	//	log.Fatalf("Decryption failed: %s", err)
-	//}
-	//
-	//// If the message is successfully decrypted, then client and server
-	//// can talk to each other using the key they derived
-	//fmt.Printf("S -> C: %s\n", message)
-	//
-	//// Client must generate a new nonce for all messages it sends.
-	//// It MUST NOT reuse the nonce that was used in the message
-	//// it received when encrypting a different message.
-	//
-	//// get a fresh nonce
-	//if n, err := rand.Read(nonce); err != nil {
-	//	log.Fatal(err)
-	//} else if n != 12 {
-	//	log.Fatal("failed to generate 12 byte nonce")
-	//}
-	//
-	//reply := []byte("Send me chocolate, not bits!")
-	//
-	//replyCipherText := clientCryptor.Seal(nil, nonce, reply, nil)
-	//// Note that this is a new nonce.
-	//
-	//// client sends the new nonce and the reply to the server.
-	//
-	//plainReply, err := serverCryptor.Open(nil, nonce, replyCipherText, nil)
-	//if err != nil {
-	//	log.Fatalf("Decryption failed: %s", err)
-	//}
-	//fmt.Printf("C -> S: %s\n", plainReply)
-	//// Output: S -> C: Hi client! Will you be my Valentine?
-	//// C -> S: Send me chocolate, not bits!
+	groups  map[string]*Group
+	def     *Group
+	minBits int
+}
+
+var bigOne = big.NewInt(1)
+
+// New will create a new SRP for the SupportedGroups. Verifiers are made for
+// def by default and may be made for any group of at least minBits, sessions
+// of existing users can run in any of them.
+func New(def int, minBits int) (*SRP, error) {
+	s := &SRP{
+		groups:  make(map[string]*Group),
+		minBits: minBits,
+	}
+	for _, id := range SupportedGroups {
+		g := &Group{Group: srp.KnownGroups[id]}
+		s.groups[g.ID()] = g
+		if id == def {
+			s.def = g
+		}
+	}
+
+	if s.def == nil {
+		return nil, fmt.Errorf("unsupported srp group %d", def)
+	}
+	if s.def.Bits() < minBits {
+		return nil, fmt.Errorf("default srp group %s is smaller than %d bits", s.def.ID(), minBits)
+	}
+
+	return s, nil
+}
+
+// Group will return the group with the given id
+func (s *SRP) Group(id string) (password.Group, error) {
+	g, ok := s.groups[id]
+	if !ok {
+		return nil, password.ErrUnknownGroup
+	}
+
+	return g, nil
+}
+
+// DefaultGroup will return the group new verifiers should be made for
+func (s *SRP) DefaultGroup() password.Group {
+	return s.def
+}
+
+// Groups will return the groups of at least MinBits, smallest first
+func (s *SRP) Groups() []password.Group {
+	var groups []password.Group
+	for _, g := range s.groups {
+		if g.Bits() >= s.minBits {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Bits() < groups[j].Bits()
+	})
+
+	return groups
+}
+
+// MinBits will return the smallest group size new verifiers may be made for
+func (s *SRP) MinBits() int {
+	return s.minBits
+}
+
+// Group is a single RFC 5054 group
+type Group struct {
+	Group *srp.Group
+}
+
+// ID will return the label of the group
+func (g *Group) ID() string {
+	return g.Group.Label
+}
+
+// Bits will return the size of the prime
+func (g *Group) Bits() int {
+	return g.Group.N().BitLen()
+}
+
+// Prime will return N
+func (g *Group) Prime() *big.Int {
+	return new(big.Int).Set(g.Group.N())
+}
+
+// Generator will return g
+func (g *Group) Generator() *big.Int {
+	return new(big.Int).Set(g.Group.Generator())
+}
+
+// ValidateVerifier makes sure v is a member of the group. A verifier of 0, 1
+// or anything sharing a factor with N would let anyone authenticate.
+func (g *Group) ValidateVerifier(v *big.Int) error {
+	if v == nil || v.Cmp(bigOne) <= 0 || v.Cmp(g.Group.N()) >= 0 {
+		return password.ErrBadVerifier
+	}
+
+	if new(big.Int).GCD(nil, nil, v, g.Group.N()).Cmp(bigOne) != 0 {
+		return password.ErrBadVerifier
+	}
+
+	return nil
+}
+
+// Verifier will compute v = g^x for the private key x
+func (g *Group) Verifier(x *big.Int) (*big.Int, error) {
+	client := srp.NewSRPClient(g.Group, x, nil)
+	if client == nil {
+		return nil, errors.New("could not set up srp client")
+	}
+
+	return client.Verifier()
+}
+
+// Server is the server side of a single authentication session.
+//
+// The flow is the standard SRP-6a one:
+//
+//	Client -> Server:  username, A
+//	Server -> Client:  salt, B
+//	Client -> Server:  M1 = H(H(N) xor H(g), H(I), s, A, B, K)
+//	Server -> Client:  M2 = H(A, M1, K)
+//
+// The server must only reveal M2 once it has checked M1.
+type Server struct {
+	srp      *srp.SRP
+	username string
+	salt     []byte
+}
+
+// NewSession will set up the server side of a session for the stored
+// verifier and the client's ephemeral public key A.
+func (g *Group) NewSession(username string, salt []byte, verifier, A *big.Int) (password.Session, error) {
+	server := srp.NewSRPServer(g.Group, verifier, nil)
+	if server == nil {
+		return nil, errors.New("could not set up srp server")
+	}
+
+	// we MUST check this as defense against a malicious A sent by the client
+	if err := server.SetOthersPublic(A); err != nil {
+		return nil, password.ErrBadPublic
+	}
+
+	if B := server.EphemeralPublic(); B == nil {
+		return nil, errors.New("could not make B")
+	}
+
+	if _, err := server.Key(); err != nil {
+		return nil, fmt.Errorf("could not make session key: %w", err)
+	}
+
+	return &Server{
+		srp:      server,
+		username: username,
+		salt:     salt,
+	}, nil
+}
+
+// EphemeralPublic returns B which needs to be sent to the client
+func (s *Server) EphemeralPublic() *big.Int {
+	return s.srp.EphemeralPublic()
+}
+
+// Verify checks the client proof M1 and returns the server proof M2.
+// M2 must not be sent to the client when an error is returned.
+func (s *Server) Verify(clientProof []byte) ([]byte, error) {
+	// the library calls M1 the server proof and M2 the client proof,
+	// we use the SRP-6a names and have the client prove itself first.
+	expected, err := s.srp.M(s.salt, s.username)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(expected, clientProof) != 1 {
+		return nil, password.ErrBadProof
+	}
+
+	return s.srp.ClientProof()
+}
+
+// Key returns the shared session key K
+func (s *Server) Key() ([]byte, error) {
+	return s.srp.Key()
+}
+
+// EncodeInt will hex encode a big int for the wire
+func EncodeInt(n *big.Int) string {
+	return n.Text(16)
+}
+
+// DecodeInt will decode a hex encoded big int from the wire
+func DecodeInt(s string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() <= 0 {
+		return nil, fmt.Errorf("malformed number %q", s)
+	}
+
+	return n, nil
 }
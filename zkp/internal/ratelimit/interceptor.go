@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// usernameRequest is any request that names the account it acts on
+type usernameRequest interface {
+	GetUsername() string
+}
+
+// UnaryServerInterceptor limits the methods given, or every method when none
+// are, per peer address and per username of a tenant. Locked accounts are
+// turned away before they reach the handler.
+func UnaryServerInterceptor(l *Limiter, methods ...string) grpc.UnaryServerInterceptor {
+	limited := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		limited[m] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(limited) > 0 && !limited[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		if ok, wait := l.AllowPeer(peerAddress(ctx)); !ok {
+			return nil, exhausted(ctx, wait, "too many requests")
+		}
+
+		if r, ok := req.(usernameRequest); ok && r.GetUsername() != "" {
+			key := tenant.Key(tenant.FromContext(ctx, req), r.GetUsername())
+			if ok, wait := l.AllowUser(key); !ok {
+				return nil, exhausted(ctx, wait, "too many requests for this account")
+			}
+			if locked, wait := l.Locked(key); locked {
+				return nil, exhausted(ctx, wait, "account is temporarily locked")
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// peerAddress returns the host of the calling peer without its port, as
+// every new connection gets a new one
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// exhausted returns a ResourceExhausted status telling the client when to
+// come back, both as retry-after metadata in seconds and as RetryInfo
+func exhausted(ctx context.Context, wait time.Duration, description string) error {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+
+	st := status.New(codes.ResourceExhausted, description)
+	ds, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(wait),
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return ds.Err()
+}
@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// sweepInterval is how often idle buckets and expired lockouts are forgotten
+const sweepInterval = time.Minute
+
+// Config holds the limits applied to the Auth service
+type Config struct {
+	PeerRate  float64 // requests per second a single peer address may make
+	PeerBurst int
+	UserRate  float64 // requests per second that may name a single username
+	UserBurst int
+
+	LockoutThreshold int           // bad proofs before an account is locked
+	LockoutBase      time.Duration // first lockout, doubled for every further bad proof
+	LockoutMax       time.Duration
+}
+
+// DefaultConfig is used for any limit left at zero
+var DefaultConfig = Config{
+	PeerRate:         5,
+	PeerBurst:        20,
+	UserRate:         1,
+	UserBurst:        5,
+	LockoutThreshold: 5,
+	LockoutBase:      time.Second,
+	LockoutMax:       time.Hour,
+}
+
+// lockout tracks bad proofs for a single account
+type lockout struct {
+	failures int
+	last     time.Time // the most recent bad proof
+	until    time.Time
+}
+
+// Limiter keeps token buckets per peer and per username, and locks accounts
+// with exponential back-off after repeated bad proofs. A nil Limiter allows everything.
+type Limiter struct {
+	Config Config
+
+	mu        sync.Mutex
+	peers     map[string]*rate.Limiter
+	users     map[string]*rate.Limiter
+	lockouts  map[string]*lockout
+	lastSweep time.Time
+}
+
+// AllowPeer takes a token from the peer's bucket. When none is left it
+// returns false and how long until the next one.
+func (l *Limiter) AllowPeer(addr string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	return l.allow(l.peers, addr, l.Config.PeerRate, l.Config.PeerBurst)
+}
+
+// AllowUser takes a token from the username's bucket. When none is left it
+// returns false and how long until the next one.
+func (l *Limiter) AllowUser(username string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	return l.allow(l.users, username, l.Config.UserRate, l.Config.UserBurst)
+}
+
+// Locked reports whether the account is locked and for how much longer
+func (l *Limiter) Locked(username string) (bool, time.Duration) {
+	if l == nil {
+		return false, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lo, ok := l.lockouts[username]
+	if !ok {
+		return false, 0
+	}
+	if wait := time.Until(lo.until); wait > 0 {
+		return true, wait
+	}
+
+	return false, 0
+}
+
+// Failure records a bad proof for the account. Once the threshold is reached
+// every further failure doubles the lockout, up to LockoutMax. It returns
+// how long the account is now locked for, or zero when it is not.
+func (l *Limiter) Failure(username string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	return l.FailureThreshold(username, l.Config.LockoutThreshold)
+}
+
+// FailureThreshold is Failure with a threshold of its own, for accounts
+// whose tenant sets one. A threshold of zero or less means the configured one.
+func (l *Limiter) FailureThreshold(username string, threshold int) time.Duration {
+	if l == nil {
+		return 0
+	}
+	if threshold <= 0 {
+		threshold = l.Config.LockoutThreshold
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lo, ok := l.lockouts[username]
+	if !ok {
+		lo = &lockout{}
+		l.lockouts[username] = lo
+	}
+	lo.failures++
+	lo.last = time.Now()
+
+	if over := lo.failures - threshold; over >= 0 {
+		wait := l.Config.LockoutMax
+		if over < 32 {
+			if d := l.Config.LockoutBase << uint(over); d > 0 && d < wait {
+				wait = d
+			}
+		}
+		lo.until = lo.last.Add(wait)
+		return wait
+	}
+
+	return 0
+}
+
+// Success forgets the bad proofs of an account once it logs in
+func (l *Limiter) Success(username string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.lockouts, username)
+}
+
+func (l *Limiter) allow(buckets map[string]*rate.Limiter, key string, r float64, burst int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := buckets[key]
+	if !ok {
+		b = rate.NewLimiter(rate.Limit(r), burst)
+		buckets[key] = b
+	}
+
+	res := b.ReserveN(now, 1)
+	if !res.OK() {
+		return false, sweepInterval
+	}
+	if wait := res.DelayFrom(now); wait > 0 {
+		res.CancelAt(now)
+		return false, wait
+	}
+
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled and lockouts that have run out
+// so the maps do not grow with every address and username we have ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for _, buckets := range []map[string]*rate.Limiter{l.peers, l.users} {
+		for key, b := range buckets {
+			if b.TokensAt(now) >= float64(b.Burst()) {
+				delete(buckets, key)
+			}
+		}
+	}
+	for username, lo := range l.lockouts {
+		if now.After(lo.until) && now.Sub(lo.last) > l.Config.LockoutMax {
+			delete(l.lockouts, username)
+		}
+	}
+}
+
+// New will create a limiter, any limit left at zero takes its default
+func New(c Config) *Limiter {
+	if c.PeerRate <= 0 {
+		c.PeerRate = DefaultConfig.PeerRate
+	}
+	if c.PeerBurst <= 0 {
+		c.PeerBurst = DefaultConfig.PeerBurst
+	}
+	if c.UserRate <= 0 {
+		c.UserRate = DefaultConfig.UserRate
+	}
+	if c.UserBurst <= 0 {
+		c.UserBurst = DefaultConfig.UserBurst
+	}
+	if c.LockoutThreshold <= 0 {
+		c.LockoutThreshold = DefaultConfig.LockoutThreshold
+	}
+	if c.LockoutBase <= 0 {
+		c.LockoutBase = DefaultConfig.LockoutBase
+	}
+	if c.LockoutMax <= 0 {
+		c.LockoutMax = DefaultConfig.LockoutMax
+	}
+
+	return &Limiter{
+		Config:   c,
+		peers:    make(map[string]*rate.Limiter),
+		users:    make(map[string]*rate.Limiter),
+		lockouts: make(map[string]*lockout),
+	}
+}
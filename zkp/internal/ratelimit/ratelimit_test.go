@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	pb "github.com/imthaghost/goland/zkp/rpc/zkp"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int // passed to FailureThreshold, 0 for the configured one
+		want      []time.Duration
+	}{
+		{
+			// locked on the third, then doubled up to the max
+			name: "backoff",
+			want: []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:      "tenant threshold",
+			threshold: 1,
+			want:      []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(Config{LockoutThreshold: 3, LockoutBase: time.Second, LockoutMax: 10 * time.Second})
+
+			for i, want := range tt.want {
+				if got := l.FailureThreshold("alice", tt.threshold); got != want {
+					t.Errorf("failure %d locks for %v, want %v", i+1, got, want)
+				}
+			}
+
+			locked, wait := l.Locked("alice")
+			if !locked || wait <= 0 {
+				t.Errorf("Locked() = %v, %v, want locked", locked, wait)
+			}
+			if locked, _ := l.Locked("bob"); locked {
+				t.Error("Locked(bob) = true, another account's failures locked it")
+			}
+
+			l.Success("alice")
+			if locked, _ := l.Locked("alice"); locked {
+				t.Error("Locked() = true after Success")
+			}
+			if got := l.Failure("alice"); got != 0 {
+				t.Errorf("Failure() after Success locks for %v, want the count to start over", got)
+			}
+		})
+	}
+}
+
+func TestLockoutRunsOut(t *testing.T) {
+	l := New(Config{LockoutThreshold: 1, LockoutBase: 10 * time.Millisecond, LockoutMax: time.Second})
+
+	if got := l.Failure("alice"); got != 10*time.Millisecond {
+		t.Fatalf("Failure() = %v, want %v", got, 10*time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if locked, _ := l.Locked("alice"); locked {
+		t.Error("Locked() = true after the lockout ran out")
+	}
+}
+
+func TestAllow(t *testing.T) {
+	l := New(Config{PeerRate: 1, PeerBurst: 2, UserRate: 1, UserBurst: 1})
+
+	for i, want := range []bool{true, true, false} {
+		if got, _ := l.AllowPeer("10.0.0.1"); got != want {
+			t.Errorf("AllowPeer() %d = %v, want %v", i, got, want)
+		}
+	}
+	if ok, wait := l.AllowPeer("10.0.0.1"); ok || wait <= 0 || wait > time.Second {
+		t.Errorf("AllowPeer() = %v, %v, want a wait of at most a second", ok, wait)
+	}
+	if ok, _ := l.AllowPeer("10.0.0.2"); !ok {
+		t.Error("AllowPeer() for another peer = false")
+	}
+
+	for i, want := range []bool{true, false} {
+		if got, _ := l.AllowUser("alice"); got != want {
+			t.Errorf("AllowUser() %d = %v, want %v", i, got, want)
+		}
+	}
+
+	var nl *Limiter
+	if ok, _ := nl.AllowPeer("10.0.0.1"); !ok {
+		t.Error("a nil Limiter turned a peer away")
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l := New(Config{PeerRate: 1000, PeerBurst: 1000, UserRate: 1000, UserBurst: 1000, LockoutThreshold: 1, LockoutBase: time.Minute})
+	intercept := UnaryServerInterceptor(l, "/auth.Auth/Login")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+
+	// accounts are keyed by tenant, the default one here
+	l.Failure(tenant.Key("", "alice"))
+
+	tests := []struct {
+		name   string
+		method string
+		req    interface{}
+		want   codes.Code
+	}{
+		{"locked account", "/auth.Auth/Login", &pb.LoginRequest{Username: "alice"}, codes.ResourceExhausted},
+		{"other account", "/auth.Auth/Login", &pb.LoginRequest{Username: "bob"}, codes.OK},
+		{"method not limited", "/auth.Auth/Logout", &pb.LoginRequest{Username: "alice"}, codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := intercept(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			st := status.Convert(err)
+			if st.Code() != tt.want {
+				t.Fatalf("code = %v, want %v", st.Code(), tt.want)
+			}
+			if tt.want != codes.ResourceExhausted {
+				return
+			}
+
+			// clients are told when to come back
+			for _, d := range st.Details() {
+				if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay.AsDuration() > 0 {
+					return
+				}
+			}
+			t.Errorf("details = %v, want a RetryInfo", st.Details())
+		})
+	}
+}
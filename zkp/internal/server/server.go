@@ -0,0 +1,169 @@
+// Package server sets up the gRPC listener, its transport security and a
+// graceful shutdown.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/config"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ErrPlaintext is returned when no certificate is configured outside of dev
+var ErrPlaintext = errors.New("a TLS certificate is required outside of dev")
+
+// Options will turn the server config into grpc server options. appEnv
+// decides whether serving plaintext is allowed.
+func Options(cfg config.ServerConfig, appEnv string) ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: cfg.KeepaliveMinTime,
+		}),
+		grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.MaxSendMsgSize),
+	}
+
+	tlsConfig, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		if appEnv != config.DEV {
+			return nil, ErrPlaintext
+		}
+		return opts, nil
+	}
+
+	return append(opts, grpc.Creds(credentials.NewTLS(tlsConfig))), nil
+}
+
+// TLSConfig will load the certificate and client CA, it returns nil when no
+// certificate is configured
+func TLSConfig(cfg config.ServerConfig) (*tls.Config, error) {
+	return loadTLS(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.ClientCAFile, tls.RequireAndVerifyClientCert)
+}
+
+// GatewayTLSConfig will load the gateway certificate, or the gRPC one when
+// the gateway has none. Its client CA only checks certificates that are
+// presented, the gRPC client CA is never used since browsers have no
+// certificate to present.
+func GatewayTLSConfig(cfg config.GatewayConfig, sc config.ServerConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		cfg.TLSCertFile, cfg.TLSKeyFile = sc.TLSCertFile, sc.TLSKeyFile
+	}
+	return loadTLS(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.ClientCAFile, tls.VerifyClientCertIfGiven)
+}
+
+// loadTLS will load a certificate and, when set, a client CA checked with
+// clientAuth
+func loadTLS(certFile, keyFile, clientCAFile string, clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("a client CA needs a TLS certificate")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = clientAuth
+	}
+
+	return tlsConfig, nil
+}
+
+// Serve will serve on lis until ctx is done, then stop taking new calls and
+// give the ones in flight until timeout to finish before cutting them off
+func Serve(ctx context.Context, s *grpc.Server, lis net.Listener, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-stopped:
+	case <-t.C:
+		s.Stop()
+		<-stopped
+	}
+
+	// Serve returns nil once GracefulStop or Stop has been called
+	return <-errs
+}
+
+// ServeHTTP will serve srv on lis until ctx is done, then shut it down the
+// same way as Serve. lis is wrapped in TLS when srv has a TLS config.
+func ServeHTTP(ctx context.Context, srv *http.Server, lis net.Listener, timeout time.Duration) error {
+	if srv.TLSConfig != nil {
+		lis = tls.NewListener(lis, srv.TLSConfig)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		srv.Close()
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/config"
+)
+
+// selfSigned writes a self-signed certificate and its key to dir, the
+// certificate doubles as a CA
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestGatewayTLSConfig(t *testing.T) {
+	certFile, keyFile := selfSigned(t, t.TempDir())
+	mtls := config.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, ClientCAFile: certFile}
+
+	tests := []struct {
+		name    string
+		gateway config.GatewayConfig
+		server  config.ServerConfig
+		wantNil bool
+		want    tls.ClientAuthType
+	}{
+		{
+			name:    "plaintext",
+			wantNil: true,
+		},
+		{
+			// browsers could not connect if the gRPC client CA carried over
+			name:   "uses the gRPC certificate but not its client CA",
+			server: mtls,
+			want:   tls.NoClientCert,
+		},
+		{
+			name:    "own certificate",
+			gateway: config.GatewayConfig{TLSCertFile: certFile, TLSKeyFile: keyFile},
+			want:    tls.NoClientCert,
+		},
+		{
+			name:    "own client CA",
+			gateway: config.GatewayConfig{ClientCAFile: certFile},
+			server:  mtls,
+			want:    tls.VerifyClientCertIfGiven,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GatewayTLSConfig(tt.gateway, tt.server)
+			if err != nil {
+				t.Fatalf("GatewayTLSConfig() error = %v", err)
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("GatewayTLSConfig() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("GatewayTLSConfig() = nil")
+			}
+			if got.ClientAuth != tt.want {
+				t.Errorf("ClientAuth = %v, want %v", got.ClientAuth, tt.want)
+			}
+		})
+	}
+
+	// the gRPC listener still insists on a client certificate
+	got, err := TLSConfig(mtls)
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	if got.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("TLSConfig() ClientAuth = %v, want %v", got.ClientAuth, tls.RequireAndVerifyClientCert)
+	}
+}
+
+func TestGatewayTLSConfigClientCAWithoutCert(t *testing.T) {
+	certFile, _ := selfSigned(t, t.TempDir())
+
+	if _, err := GatewayTLSConfig(config.GatewayConfig{ClientCAFile: certFile}, config.ServerConfig{}); err == nil {
+		t.Error("GatewayTLSConfig() error = nil, want an error for a client CA without a certificate")
+	}
+}
@@ -0,0 +1,618 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket            = []byte("meta")
+	usersBucket           = []byte("users") // schema versions 1 and 2
+	tenantUsersBucket     = []byte("tenant_users")
+	refreshTokensBucket   = []byte("refresh_tokens")
+	refreshExpiryBucket   = []byte("refresh_tokens_by_expiry")
+	revokedSessionsBucket = []byte("revoked_sessions")
+	revokedExpiryBucket   = []byte("revoked_sessions_by_expiry")
+	revokedUsersBucket    = []byte("revoked_users")
+	tenantsBucket         = []byte("tenants")
+	dataKeysBucket        = []byte("data_keys")
+
+	versionKey = []byte("schema_version")
+)
+
+// migrations bring the schema from version i to i+1. Never edit or reorder
+// a migration once it has shipped, append a new one instead.
+var migrations = []func(tx *bolt.Tx) error{
+	// 0 -> 1: users keyed by username
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usersBucket)
+		return err
+	},
+	// 1 -> 2: refresh tokens and the revocation list, both indexed by
+	// expiry so expired entries can be purged without reading the others
+	func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{refreshTokensBucket, refreshExpiryBucket, revokedSessionsBucket, revokedExpiryBucket, revokedUsersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2 -> 3: users keyed by username in a bucket per tenant, the ones we
+	// have belong to the default tenant. The tenant buckets live apart from
+	// the old users bucket, whose keys are usernames and may be any tenant ID.
+	func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tenantsBucket); err != nil {
+			return err
+		}
+
+		users, err := tenantUsersBucketFor(tx, tenant.Default)
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(users, tx.Bucket(usersBucket)); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(usersBucket)
+	},
+	// 3 -> 4: wrapped data keys for sealing users at rest
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(dataKeysBucket)
+		return err
+	},
+}
+
+// expiryKey is the key of an expiry index entry, the expiry first so the
+// index is ordered by it and then the key of the entry it points at
+func expiryKey(at time.Time, key []byte) []byte {
+	k := make([]byte, 0, 8+len(key))
+	k = append(k, encodeTime(at)...)
+	return append(k, key...)
+}
+
+// purgeExpired deletes the entries of data that expired by now, walking the
+// index from the oldest until the first one that has not
+func purgeExpired(idx, data *bolt.Bucket, now time.Time) error {
+	var expired [][]byte
+	c := idx.Cursor()
+	for k, _ := c.First(); k != nil && len(k) >= 8 && !decodeTime(k[:8]).After(now); k, _ = c.Next() {
+		expired = append(expired, append([]byte(nil), k...))
+	}
+
+	for _, k := range expired {
+		if err := data.Delete(k[8:]); err != nil {
+			return err
+		}
+		if err := idx.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenantUsersBucketFor returns the bucket of the tenant's users, creating it if needed
+func tenantUsersBucketFor(tx *bolt.Tx, tenantID string) (*bolt.Bucket, error) {
+	all, err := tx.CreateBucketIfNotExists(tenantUsersBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return all.CreateBucketIfNotExists([]byte(tenant.Normalize(tenantID)))
+}
+
+// copyBucket copies every key of src that holds a value into dst. The keys
+// are gathered first so dst is never written while src is being iterated.
+func copyBucket(dst, src *bolt.Bucket) error {
+	var keys, values [][]byte
+	err := src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range keys {
+		if err := dst.Put(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bolt is a file backed database. Every write happens in a single bolt
+// transaction so it is either fully applied or not at all.
+type Bolt struct {
+	DB *bolt.DB
+}
+
+// CreateUser will create a user unless the username is taken in its tenant
+func (b *Bolt) CreateUser(u *store.User) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		users, err := tenantUsersBucketFor(tx, u.Tenant)
+		if err != nil {
+			return err
+		}
+		if users.Get([]byte(u.Username)) != nil {
+			return store.ErrUserExists
+		}
+
+		return putUser(users, u)
+	})
+}
+
+// GetUserByUsername will return the user of the tenant by the given username
+func (b *Bolt) GetUserByUsername(tenantID, username string) (*store.User, error) {
+	var u *store.User
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		users := tenantUsers(tx, tenantID)
+		if users == nil {
+			return store.ErrNotFound
+		}
+		data := users.Get([]byte(username))
+		if data == nil {
+			return store.ErrNotFound
+		}
+
+		u = &store.User{}
+		return json.Unmarshal(data, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// UpdateUser will replace an existing user
+func (b *Bolt) UpdateUser(u *store.User) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		users := tenantUsers(tx, u.Tenant)
+		if users == nil || users.Get([]byte(u.Username)) == nil {
+			return store.ErrNotFound
+		}
+
+		return putUser(users, u)
+	})
+}
+
+// ModifyUser will apply fn to the user and store it if fn succeeds
+func (b *Bolt) ModifyUser(tenantID, username string, fn func(*store.User) error) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		users := tenantUsers(tx, tenantID)
+		if users == nil {
+			return store.ErrNotFound
+		}
+		data := users.Get([]byte(username))
+		if data == nil {
+			return store.ErrNotFound
+		}
+
+		u := &store.User{}
+		if err := json.Unmarshal(data, u); err != nil {
+			return err
+		}
+		t := u.Tenant
+		if err := fn(u); err != nil {
+			return err
+		}
+		u.Tenant, u.Username = t, username
+
+		return putUser(users, u)
+	})
+}
+
+// DeleteUser will remove the user of the tenant with the given username
+func (b *Bolt) DeleteUser(tenantID, username string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		users := tenantUsers(tx, tenantID)
+		if users == nil || users.Get([]byte(username)) == nil {
+			return store.ErrNotFound
+		}
+
+		return users.Delete([]byte(username))
+	})
+}
+
+// ListUsers will return every user of the tenant ordered by username
+func (b *Bolt) ListUsers(tenantID string) ([]*store.User, error) {
+	var users []*store.User
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		bucket := tenantUsers(tx, tenantID)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			u := &store.User{}
+			if err := json.Unmarshal(v, u); err != nil {
+				return fmt.Errorf("could not decode user %q: %w", k, err)
+			}
+			users = append(users, u)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SearchUsers will return the users of the tenant selected by the query
+// ordered by username, starting the scan right after q.After
+func (b *Bolt) SearchUsers(tenantID string, q store.UserQuery) ([]*store.User, error) {
+	users := []*store.User{}
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		bucket := tenantUsers(tx, tenantID)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek([]byte(q.After)); k != nil; k, v = c.Next() {
+			if q.Limit > 0 && len(users) == q.Limit {
+				break
+			}
+			if !q.Match(string(k)) {
+				continue
+			}
+			u := &store.User{}
+			if err := json.Unmarshal(v, u); err != nil {
+				return fmt.Errorf("could not decode user %q: %w", k, err)
+			}
+			users = append(users, u)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// CreateTenant will create a tenant unless the ID is taken
+func (b *Bolt) CreateTenant(t *store.Tenant) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		tenants := tx.Bucket(tenantsBucket)
+		if tenants.Get([]byte(t.ID)) != nil {
+			return store.ErrTenantExists
+		}
+
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return tenants.Put([]byte(t.ID), data)
+	})
+}
+
+// GetTenant will return the tenant with the given ID
+func (b *Bolt) GetTenant(id string) (*store.Tenant, error) {
+	var t *store.Tenant
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tenantsBucket).Get([]byte(id))
+		if data == nil {
+			if id == tenant.Default {
+				t = &store.Tenant{ID: tenant.Default}
+				return nil
+			}
+			return store.ErrTenantNotFound
+		}
+
+		t = &store.Tenant{}
+		return json.Unmarshal(data, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// ListTenants will return every tenant ordered by ID
+func (b *Bolt) ListTenants() ([]*store.Tenant, error) {
+	var tenants []*store.Tenant
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tenantsBucket)
+		if bucket.Get([]byte(tenant.Default)) == nil {
+			tenants = append(tenants, &store.Tenant{ID: tenant.Default})
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			t := &store.Tenant{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return fmt.Errorf("could not decode tenant %q: %w", k, err)
+			}
+			tenants = append(tenants, t)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+
+	return tenants, nil
+}
+
+// CreateRefreshToken will store a refresh token and forget expired ones
+func (b *Bolt) CreateRefreshToken(t *store.RefreshToken) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		tokens, idx := tx.Bucket(refreshTokensBucket), tx.Bucket(refreshExpiryBucket)
+		if err := purgeExpired(idx, tokens, time.Now()); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err := tokens.Put([]byte(t.Hash), data); err != nil {
+			return err
+		}
+		return idx.Put(expiryKey(t.ExpiresAt, []byte(t.Hash)), []byte{})
+	})
+}
+
+// UseRefreshToken will mark a refresh token as used and return it as it was
+func (b *Bolt) UseRefreshToken(hash string) (*store.RefreshToken, error) {
+	var rt *store.RefreshToken
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		tokens := tx.Bucket(refreshTokensBucket)
+		data := tokens.Get([]byte(hash))
+		if data == nil {
+			return store.ErrNotFound
+		}
+
+		rt = &store.RefreshToken{}
+		if err := json.Unmarshal(data, rt); err != nil {
+			return err
+		}
+
+		used := *rt
+		used.Used = true
+		data, err := json.Marshal(&used)
+		if err != nil {
+			return err
+		}
+		return tokens.Put([]byte(hash), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// ListRefreshTokens will return the unexpired refresh tokens of the user,
+// oldest first. Tokens are keyed by hash so every one of them is scanned.
+func (b *Bolt) ListRefreshTokens(tenantID, username string) ([]*store.RefreshToken, error) {
+	now := time.Now()
+	key := tenant.Key(tenantID, username)
+	tokens := []*store.RefreshToken{}
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(refreshTokensBucket).ForEach(func(k, v []byte) error {
+			rt := &store.RefreshToken{}
+			if err := json.Unmarshal(v, rt); err != nil {
+				return fmt.Errorf("could not decode refresh token: %w", err)
+			}
+			if tenant.Key(rt.Tenant, rt.Username) == key && !now.After(rt.ExpiresAt) {
+				tokens = append(tokens, rt)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].IssuedAt.Before(tokens[j].IssuedAt)
+	})
+
+	return tokens, nil
+}
+
+// RevokeSession will add a session to the revocation list and forget expired entries
+func (b *Bolt) RevokeSession(sessionID string, until time.Time) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		revoked, idx := tx.Bucket(revokedSessionsBucket), tx.Bucket(revokedExpiryBucket)
+		if err := purgeExpired(idx, revoked, time.Now()); err != nil {
+			return err
+		}
+
+		// a session revoked again keeps only its latest entry
+		if v := revoked.Get([]byte(sessionID)); v != nil {
+			if err := idx.Delete(expiryKey(decodeTime(v), []byte(sessionID))); err != nil {
+				return err
+			}
+		}
+		if err := revoked.Put([]byte(sessionID), encodeTime(until)); err != nil {
+			return err
+		}
+		return idx.Put(expiryKey(until, []byte(sessionID)), []byte{})
+	})
+}
+
+// RevokeUserSessions will revoke every session of the user issued before at
+func (b *Bolt) RevokeUserSessions(tenantID, username string, at time.Time) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(revokedUsersBucket).Put([]byte(tenant.Key(tenantID, username)), encodeTime(at))
+	})
+}
+
+// IsRevoked will report whether the session or every session of the user was revoked
+func (b *Bolt) IsRevoked(tenantID, username, sessionID string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(revokedSessionsBucket).Get([]byte(sessionID)) != nil {
+			revoked = true
+			return nil
+		}
+		if v := tx.Bucket(revokedUsersBucket).Get([]byte(tenant.Key(tenantID, username))); v != nil {
+			revoked = issuedAt.Before(decodeTime(v))
+		}
+		return nil
+	})
+
+	return revoked, err
+}
+
+// PutDataKey will store a wrapped data key
+func (b *Bolt) PutDataKey(k *store.DataKey) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(dataKeysBucket).Put([]byte(k.ID), data)
+	})
+}
+
+// ListDataKeys will return every data key, oldest first
+func (b *Bolt) ListDataKeys() ([]*store.DataKey, error) {
+	keys := []*store.DataKey{}
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(dataKeysBucket).ForEach(func(k, v []byte) error {
+			dk := &store.DataKey{}
+			if err := json.Unmarshal(v, dk); err != nil {
+				return fmt.Errorf("could not decode data key %q: %w", k, err)
+			}
+			keys = append(keys, dk)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// DeleteDataKey will remove a data key
+func (b *Bolt) DeleteDataKey(id string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dataKeysBucket).Delete([]byte(id))
+	})
+}
+
+// Ping will read the schema version to make sure the file is open and migrated
+func (b *Bolt) Ping() error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return fmt.Errorf("missing %s bucket", metaBucket)
+		}
+		v := meta.Get(versionKey)
+		if len(v) != 8 || binary.BigEndian.Uint64(v) != uint64(len(migrations)) {
+			return fmt.Errorf("unexpected schema version")
+		}
+
+		return nil
+	})
+}
+
+// Close will close the underlying database file
+func (b *Bolt) Close() error {
+	return b.DB.Close()
+}
+
+// tenantUsers returns the bucket of the tenant's users, nil if it has none yet
+func tenantUsers(tx *bolt.Tx, tenantID string) *bolt.Bucket {
+	all := tx.Bucket(tenantUsersBucket)
+	if all == nil {
+		return nil
+	}
+
+	return all.Bucket([]byte(tenant.Normalize(tenantID)))
+}
+
+func putUser(users *bolt.Bucket, u *store.User) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	return users.Put([]byte(u.Username), data)
+}
+
+func encodeTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+func decodeTime(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// migrate runs every migration the database has not seen yet. They all run
+// in one transaction so a failed upgrade leaves the file untouched.
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		var version uint64
+		if v := meta.Get(versionKey); v != nil {
+			version = binary.BigEndian.Uint64(v)
+		}
+		if version > uint64(len(migrations)) {
+			return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", version, len(migrations))
+		}
+
+		for ; version < uint64(len(migrations)); version++ {
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration to schema version %d failed: %w", version+1, err)
+			}
+		}
+
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, version)
+		return meta.Put(versionKey, v)
+	})
+}
+
+// New will open, creating if needed, the database at path and bring its schema up to date
+func New(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Bolt{
+		DB: db,
+	}, nil
+}
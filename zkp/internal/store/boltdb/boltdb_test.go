@@ -0,0 +1,255 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// fixture writes a database at the given schema version with its buckets
+// laid out by fill, the way an older binary left it
+func fixture(t *testing.T, version uint64, fill func(tx *bolt.Tx) error) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "zkp.db")
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, version)
+		if err := meta.Put(versionKey, v); err != nil {
+			return err
+		}
+
+		return fill(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// putUsers stores users as JSON keyed by username
+func putUsers(b *bolt.Bucket, usernames ...string) error {
+	for _, name := range usernames {
+		data, err := json.Marshal(&store.User{Username: name, Salt: "00", Verifier: "02"})
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		version uint64
+		fill    func(tx *bolt.Tx) error
+		want    map[string][]string // tenant -> usernames
+	}{
+		{
+			// a username that is also a tenant ID stays a user
+			name:    "v2 with a user named default",
+			version: 2,
+			fill: func(tx *bolt.Tx) error {
+				for _, b := range [][]byte{refreshTokensBucket, refreshExpiryBucket, revokedSessionsBucket, revokedExpiryBucket, revokedUsersBucket} {
+					if _, err := tx.CreateBucket(b); err != nil {
+						return err
+					}
+				}
+				users, err := tx.CreateBucket(usersBucket)
+				if err != nil {
+					return err
+				}
+				return putUsers(users, "default", "bob")
+			},
+			want: map[string][]string{"default": {"bob", "default"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(fixture(t, tt.version, tt.fill))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			defer b.Close()
+
+			for tenantID, want := range tt.want {
+				users, err := b.ListUsers(tenantID)
+				if err != nil {
+					t.Fatalf("ListUsers(%q) error = %v", tenantID, err)
+				}
+				var got []string
+				for _, u := range users {
+					got = append(got, u.Username)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("ListUsers(%q) = %v, want %v", tenantID, got, want)
+				}
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("ListUsers(%q) = %v, want %v", tenantID, got, want)
+					}
+				}
+			}
+
+			err = b.DB.View(func(tx *bolt.Tx) error {
+				if tx.Bucket(usersBucket) != nil {
+					t.Error("old users bucket was not removed")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the migrated database takes new users in any tenant
+			if err := b.CreateUser(&store.User{Username: "carol"}); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			if _, err := b.GetUserByUsername("", "carol"); err != nil {
+				t.Fatalf("GetUserByUsername() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateFresh(t *testing.T) {
+	b, err := New(filepath.Join(t.TempDir(), "zkp.db"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer b.Close()
+
+	if err := b.CreateUser(&store.User{Tenant: "acme", Username: "default"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := b.GetUserByUsername("", "default"); err != store.ErrNotFound {
+		t.Fatalf("GetUserByUsername() in the default tenant error = %v, want %v", err, store.ErrNotFound)
+	}
+	if err := b.Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+}
+
+// count returns how many keys the bucket holds
+func count(t *testing.T, b *Bolt, bucket []byte) int {
+	t.Helper()
+
+	n := 0
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestCreateRefreshTokenPurgesExpired(t *testing.T) {
+	b, err := New(filepath.Join(t.TempDir(), "zkp.db"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer b.Close()
+
+	now := time.Now()
+	tokens := []*store.RefreshToken{
+		{Hash: "expired-1", Username: "alice", ExpiresAt: now.Add(-time.Hour)},
+		{Hash: "expired-2", Username: "alice", ExpiresAt: now.Add(-time.Minute)},
+		{Hash: "live", Username: "alice", ExpiresAt: now.Add(time.Hour)},
+		{Hash: "new", Username: "alice", ExpiresAt: now.Add(2 * time.Hour)},
+	}
+	for _, rt := range tokens {
+		if err := b.CreateRefreshToken(rt); err != nil {
+			t.Fatalf("CreateRefreshToken(%s) error = %v", rt.Hash, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		hash string
+		want error
+	}{
+		{"expired-1", store.ErrNotFound},
+		{"expired-2", store.ErrNotFound},
+		{"live", nil},
+		{"new", nil},
+	} {
+		if _, err := b.UseRefreshToken(tt.hash); err != tt.want {
+			t.Errorf("UseRefreshToken(%s) error = %v, want %v", tt.hash, err, tt.want)
+		}
+	}
+	if n := count(t, b, refreshExpiryBucket); n != 2 {
+		t.Errorf("expiry index holds %d entries, want 2", n)
+	}
+}
+
+func TestRevokeSessionPurgesExpired(t *testing.T) {
+	b, err := New(filepath.Join(t.TempDir(), "zkp.db"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer b.Close()
+
+	now := time.Now()
+	revocations := []struct {
+		sessionID string
+		until     time.Time
+	}{
+		{"expired", now.Add(-time.Minute)},
+		{"again", now.Add(-time.Hour)},
+		{"again", now.Add(time.Hour)}, // revoked again, the later entry wins
+		{"live", now.Add(time.Hour)},
+	}
+	for _, r := range revocations {
+		if err := b.RevokeSession(r.sessionID, r.until); err != nil {
+			t.Fatalf("RevokeSession(%s) error = %v", r.sessionID, err)
+		}
+	}
+	if err := b.RevokeSession("last", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeSession(last) error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		sessionID string
+		want      bool
+	}{
+		{"expired", false},
+		{"again", true},
+		{"live", true},
+		{"last", true},
+	} {
+		got, err := b.IsRevoked("", "alice", tt.sessionID, now)
+		if err != nil {
+			t.Fatalf("IsRevoked(%s) error = %v", tt.sessionID, err)
+		}
+		if got != tt.want {
+			t.Errorf("IsRevoked(%s) = %v, want %v", tt.sessionID, got, tt.want)
+		}
+	}
+	if n := count(t, b, revokedExpiryBucket); n != 3 {
+		t.Errorf("expiry index holds %d entries, want 3", n)
+	}
+}
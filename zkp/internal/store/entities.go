@@ -1,7 +1,143 @@
 package store
 
+import (
+	"strings"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/kdf"
+)
+
 type User struct {
-	Username string
-	Salt     string
-	GroupID  string
+	// Tenant is the namespace of the user, users stored before tenants
+	// existed have none, which means tenant.Default
+	Tenant   string `json:"tenant,omitempty"`
+	Username string `json:"username"`
+	Salt     string `json:"salt"`
+	GroupID  string `json:"group_id"`
+	Verifier string `json:"verifier"`
+	// KDF is how the client derives x from the password, users stored
+	// before it was recorded have none, which means kdf.RFC5054
+	KDF kdf.Params `json:"kdf"`
+	// TOTP is the user's second factor, if they enrolled one
+	TOTP *TOTP `json:"totp,omitempty"`
+	// Lock is set while an admin has locked the account
+	Lock *Lock `json:"lock,omitempty"`
+	// ResetRequired is set when an admin forced a password reset, the
+	// next login can only change the password
+	ResetRequired bool `json:"reset_required,omitempty"`
+}
+
+// Clone returns a deep copy of the user
+func (u *User) Clone() *User {
+	c := *u
+	if u.TOTP != nil {
+		t := *u.TOTP
+		t.RecoveryCodes = append([]string(nil), u.TOTP.RecoveryCodes...)
+		c.TOTP = &t
+	}
+	if u.Lock != nil {
+		l := *u.Lock
+		c.Lock = &l
+	}
+
+	return &c
+}
+
+// Lock is an admin lock on an account, nobody can log in until it is lifted
+type Lock struct {
+	Reason string `json:"reason,omitempty"`
+	// By names the admin credential that locked the account
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// UserQuery selects a page of users
+type UserQuery struct {
+	// Contains keeps the usernames that contain it, ignoring case
+	Contains string
+	// After skips the usernames up to and including it
+	After string
+	// Limit is the most users returned, none means no limit
+	Limit int
+}
+
+// Match reports whether the username is selected, ignoring Limit
+func (q UserQuery) Match(username string) bool {
+	return username > q.After && strings.Contains(strings.ToLower(username), strings.ToLower(q.Contains))
+}
+
+// TOTP is a time based one time password second factor
+type TOTP struct {
+	// Secret is base32 encoded
+	Secret string `json:"secret"`
+	// Confirmed is set once the user has shown they can make codes, until
+	// then logins do not ask for one
+	Confirmed bool `json:"confirmed"`
+	// LastStep is the time step of the last code used, no code of it or
+	// before is accepted again
+	LastStep int64 `json:"last_step"`
+	// RecoveryCodes are the hashes of the recovery codes not used yet
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Tenant is a namespace of users with its own policy
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Policy    Policy    `json:"policy"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Policy is what a tenant decides about how its users authenticate,
+// anything left zero falls back to the server's settings
+type Policy struct {
+	// Groups are the SRP groups new verifiers may be made for, the first
+	// one is suggested to clients
+	Groups []string `json:"groups,omitempty"`
+	// MinKDF is the weakest KDF new verifiers may be made with, users on a
+	// weaker one are asked to enroll again when they log in. Without it
+	// the server's KDF policy is only suggested.
+	MinKDF *kdf.Params `json:"min_kdf,omitempty"`
+	// LockoutThreshold is how many bad proofs lock an account
+	LockoutThreshold int `json:"lockout_threshold,omitempty"`
+	// TokenTTL is how long a session token is valid for
+	TokenTTL time.Duration `json:"token_ttl,omitempty"`
+	// RefreshTTL is how long a session can be kept alive by refreshing
+	RefreshTTL time.Duration `json:"refresh_ttl,omitempty"`
+}
+
+// Clone returns a deep copy of the tenant
+func (t *Tenant) Clone() *Tenant {
+	c := *t
+	c.Policy.Groups = append([]string(nil), t.Policy.Groups...)
+	if t.Policy.MinKDF != nil {
+		k := *t.Policy.MinKDF
+		c.Policy.MinKDF = &k
+	}
+
+	return &c
+}
+
+// RefreshToken is a refresh token we handed out. Only its hash is stored.
+type RefreshToken struct {
+	Hash string `json:"hash"`
+	// Tenant of the user, none means tenant.Default
+	Tenant    string `json:"tenant,omitempty"`
+	Username  string `json:"username"`
+	SessionID string `json:"session_id"`
+	// IssuedAt is when the session started, it carries over when the token is rotated
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Used is set once the token has been exchanged, seeing it again means it was stolen
+	Used bool `json:"used"`
+}
+
+// DataKey is a key that seals secret user fields at rest, see sealed. It is
+// only ever stored wrapped by a master key, which is not.
+type DataKey struct {
+	ID string `json:"id"`
+	// MasterKeyID names the master key Wrapped was sealed with
+	MasterKeyID string    `json:"master_key_id"`
+	Wrapped     []byte    `json:"wrapped"`
+	CreatedAt   time.Time `json:"created_at"`
 }
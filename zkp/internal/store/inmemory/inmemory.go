@@ -1,43 +1,371 @@
 package inmemory
 
 import (
-	"errors"
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/imthaghost/goland/zkp/internal/store"
-
-	"github.com/k0kubun/pp/v3"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
 )
 
-// InMemory is an inmemory database
-//TODO should be switched over to a concurrent map
-// or add concurrency safety
+// InMemory is an inmemory database that is safe for concurrent use.
+// Users are copied on the way in and out so callers never share them.
 type InMemory struct {
-	DB map[string]*store.User
+	mu sync.RWMutex
+	DB map[string]*store.User // tenant.Key -> user
+
+	tenants         map[string]*store.Tenant
+	refreshTokens   map[string]*store.RefreshToken
+	revokedSessions map[string]time.Time // session ID -> until
+	revokedUsers    map[string]time.Time // tenant.Key -> sessions issued before are revoked
+	dataKeys        map[string]*store.DataKey
+
+	// expired refresh tokens and revocations are found through these
+	// instead of going over every entry
+	refreshExpiry expiryIndex
+	revokedExpiry expiryIndex
 }
 
 // CreateUser will create a user in the in memory database
 func (im *InMemory) CreateUser(u *store.User) error {
-	im.DB[u.Username] = u
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	key := tenant.Key(u.Tenant, u.Username)
+	if _, ok := im.DB[key]; ok {
+		return store.ErrUserExists
+	}
+	im.DB[key] = u.Clone()
+
+	return nil
+}
+
+// GetUserByUsername will return the user of the tenant by the given username
+func (im *InMemory) GetUserByUsername(tenantID, username string) (*store.User, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	if val, ok := im.DB[tenant.Key(tenantID, username)]; ok {
+		return val.Clone(), nil
+	}
+
+	return nil, store.ErrNotFound
+}
+
+// UpdateUser will replace an existing user
+func (im *InMemory) UpdateUser(u *store.User) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	key := tenant.Key(u.Tenant, u.Username)
+	if _, ok := im.DB[key]; !ok {
+		return store.ErrNotFound
+	}
+	im.DB[key] = u.Clone()
+
+	return nil
+}
+
+// ModifyUser will apply fn to a copy of the user and store it if fn succeeds
+func (im *InMemory) ModifyUser(tenantID, username string, fn func(*store.User) error) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	key := tenant.Key(tenantID, username)
+	val, ok := im.DB[key]
+	if !ok {
+		return store.ErrNotFound
+	}
+	c := val.Clone()
+	if err := fn(c); err != nil {
+		return err
+	}
+	c.Tenant, c.Username = val.Tenant, username
+	im.DB[key] = c
+
+	return nil
+}
+
+// DeleteUser will remove the user of the tenant with the given username
+func (im *InMemory) DeleteUser(tenantID, username string) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	key := tenant.Key(tenantID, username)
+	if _, ok := im.DB[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(im.DB, key)
+
+	return nil
+}
+
+// ListUsers will return every user of the tenant ordered by username
+func (im *InMemory) ListUsers(tenantID string) ([]*store.User, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	tenantID = tenant.Normalize(tenantID)
+	var users []*store.User
+	for _, u := range im.DB {
+		if tenant.Normalize(u.Tenant) == tenantID {
+			users = append(users, u.Clone())
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users, nil
+}
+
+// SearchUsers will return the users of the tenant selected by the query
+// ordered by username
+func (im *InMemory) SearchUsers(tenantID string, q store.UserQuery) ([]*store.User, error) {
+	all, err := im.ListUsers(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*store.User{}
+	for _, u := range all {
+		if q.Limit > 0 && len(users) == q.Limit {
+			break
+		}
+		if q.Match(u.Username) {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+// CreateTenant will create a tenant in the in memory database
+func (im *InMemory) CreateTenant(t *store.Tenant) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if _, ok := im.tenants[t.ID]; ok {
+		return store.ErrTenantExists
+	}
+	im.tenants[t.ID] = t.Clone()
+
+	return nil
+}
+
+// GetTenant will return the tenant with the given ID
+func (im *InMemory) GetTenant(id string) (*store.Tenant, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	if t, ok := im.tenants[id]; ok {
+		return t.Clone(), nil
+	}
+	if id == tenant.Default {
+		return &store.Tenant{ID: tenant.Default}, nil
+	}
+
+	return nil, store.ErrTenantNotFound
+}
 
-	// for pretty purposes :)
-	pp.Print(im.DB)
+// ListTenants will return every tenant ordered by ID
+func (im *InMemory) ListTenants() ([]*store.Tenant, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	tenants := []*store.Tenant{}
+	if _, ok := im.tenants[tenant.Default]; !ok {
+		tenants = append(tenants, &store.Tenant{ID: tenant.Default})
+	}
+	for _, t := range im.tenants {
+		tenants = append(tenants, t.Clone())
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+
+	return tenants, nil
+}
+
+// CreateRefreshToken will store a refresh token and forget expired ones
+func (im *InMemory) CreateRefreshToken(t *store.RefreshToken) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	im.refreshExpiry.purge(time.Now(), func(hash string) {
+		delete(im.refreshTokens, hash)
+	})
+	c := *t
+	im.refreshTokens[t.Hash] = &c
+	heap.Push(&im.refreshExpiry, expiry{at: t.ExpiresAt, key: t.Hash})
 
 	return nil
 }
 
-// GetUserByUsername will return the user by the given username
-func (im *InMemory) GetUserByUsername(username string) (*store.User, error) {
-	if val, ok := im.DB[username]; ok {
-		return val, nil
+// UseRefreshToken will mark a refresh token as used and return it as it was
+func (im *InMemory) UseRefreshToken(hash string) (*store.RefreshToken, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	rt, ok := im.refreshTokens[hash]
+	if !ok {
+		return nil, store.ErrNotFound
 	}
+	c := *rt
+	rt.Used = true
+
+	return &c, nil
+}
+
+// ListRefreshTokens will return the unexpired refresh tokens of the user, oldest first
+func (im *InMemory) ListRefreshTokens(tenantID, username string) ([]*store.RefreshToken, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	now := time.Now()
+	key := tenant.Key(tenantID, username)
+	tokens := []*store.RefreshToken{}
+	for _, rt := range im.refreshTokens {
+		if tenant.Key(rt.Tenant, rt.Username) == key && !now.After(rt.ExpiresAt) {
+			c := *rt
+			tokens = append(tokens, &c)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].IssuedAt.Before(tokens[j].IssuedAt)
+	})
+
+	return tokens, nil
+}
+
+// RevokeSession will add a session to the revocation list and forget expired entries
+func (im *InMemory) RevokeSession(sessionID string, until time.Time) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	now := time.Now()
+	im.revokedExpiry.purge(now, func(id string) {
+		// a session revoked again is only forgotten once its latest entry runs out
+		if u, ok := im.revokedSessions[id]; ok && !u.After(now) {
+			delete(im.revokedSessions, id)
+		}
+	})
+	im.revokedSessions[sessionID] = until
+	heap.Push(&im.revokedExpiry, expiry{at: until, key: sessionID})
+
+	return nil
+}
+
+// RevokeUserSessions will revoke every session of the user issued before at
+func (im *InMemory) RevokeUserSessions(tenantID, username string, at time.Time) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
 
-	return nil, errors.New("could not retrieve user")
+	im.revokedUsers[tenant.Key(tenantID, username)] = at
+
+	return nil
+}
+
+// IsRevoked will report whether the session or every session of the user was revoked
+func (im *InMemory) IsRevoked(tenantID, username, sessionID string, issuedAt time.Time) (bool, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	if _, ok := im.revokedSessions[sessionID]; ok {
+		return true, nil
+	}
+	if at, ok := im.revokedUsers[tenant.Key(tenantID, username)]; ok && issuedAt.Before(at) {
+		return true, nil
+	}
 
+	return false, nil
+}
+
+// PutDataKey will store a wrapped data key
+func (im *InMemory) PutDataKey(k *store.DataKey) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	c := *k
+	c.Wrapped = append([]byte(nil), k.Wrapped...)
+	im.dataKeys[k.ID] = &c
+
+	return nil
+}
+
+// ListDataKeys will return every data key, oldest first
+func (im *InMemory) ListDataKeys() ([]*store.DataKey, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	keys := []*store.DataKey{}
+	for _, k := range im.dataKeys {
+		c := *k
+		c.Wrapped = append([]byte(nil), k.Wrapped...)
+		keys = append(keys, &c)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// DeleteDataKey will remove a data key
+func (im *InMemory) DeleteDataKey(id string) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	delete(im.dataKeys, id)
+
+	return nil
+}
+
+// expiry is an entry of an expiry index
+type expiry struct {
+	at  time.Time
+	key string
+}
+
+// expiryIndex is a heap of expiries with the earliest on top, for
+// container/heap
+type expiryIndex []expiry
+
+func (x expiryIndex) Len() int            { return len(x) }
+func (x expiryIndex) Less(i, j int) bool  { return x[i].at.Before(x[j].at) }
+func (x expiryIndex) Swap(i, j int)       { x[i], x[j] = x[j], x[i] }
+func (x *expiryIndex) Push(e interface{}) { *x = append(*x, e.(expiry)) }
+
+func (x *expiryIndex) Pop() interface{} {
+	old := *x
+	e := old[len(old)-1]
+	*x = old[:len(old)-1]
+	return e
+}
+
+// purge pops every entry that expired by now, oldest first, and hands its
+// key to drop
+func (x *expiryIndex) purge(now time.Time, drop func(key string)) {
+	for x.Len() > 0 && !(*x)[0].at.After(now) {
+		drop(heap.Pop(x).(expiry).key)
+	}
+}
+
+// Ping will always succeed, memory does not go away
+func (im *InMemory) Ping() error {
+	return nil
 }
 
 // New will create a new interface to interface with an inmeory database.
 func New() store.Service {
 	return &InMemory{
-		DB: make(map[string]*store.User),
+		DB:              make(map[string]*store.User),
+		tenants:         make(map[string]*store.Tenant),
+		refreshTokens:   make(map[string]*store.RefreshToken),
+		revokedSessions: make(map[string]time.Time),
+		revokedUsers:    make(map[string]time.Time),
+		dataKeys:        make(map[string]*store.DataKey),
 	}
 }
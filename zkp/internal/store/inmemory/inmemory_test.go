@@ -0,0 +1,212 @@
+package inmemory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+)
+
+func TestConcurrentUsers(t *testing.T) {
+	im := New()
+
+	// run with -race, every user is created and read from many goroutines
+	const n = 50
+	var wg sync.WaitGroup
+	created := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			username := fmt.Sprintf("user%d", i)
+			if err := im.CreateUser(&store.User{Username: username, Verifier: "02"}); err != nil {
+				t.Errorf("CreateUser(%s) error = %v", username, err)
+			}
+			if _, err := im.GetUserByUsername("", username); err != nil {
+				t.Errorf("GetUserByUsername(%s) error = %v", username, err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			created <- im.CreateUser(&store.User{Username: "alice", Verifier: "02"})
+		}()
+	}
+	wg.Wait()
+	close(created)
+
+	// only one of the goroutines racing for alice gets her
+	won := 0
+	for err := range created {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, store.ErrUserExists):
+			t.Errorf("CreateUser(alice) error = %v, want %v", err, store.ErrUserExists)
+		}
+	}
+	if won != 1 {
+		t.Errorf("CreateUser(alice) succeeded %d times, want once", won)
+	}
+
+	users, err := im.ListUsers("")
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if len(users) != n+1 {
+		t.Errorf("ListUsers() = %d users, want %d", len(users), n+1)
+	}
+}
+
+func TestUserErrors(t *testing.T) {
+	im := New()
+	if err := im.CreateUser(&store.User{Username: "alice", Verifier: "02"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "create taken username",
+			call: func() error { return im.CreateUser(&store.User{Username: "alice"}) },
+			want: store.ErrUserExists,
+		},
+		{
+			name: "create username taken in another tenant",
+			call: func() error { return im.CreateUser(&store.User{Tenant: "acme", Username: "alice"}) },
+		},
+		{
+			name: "get unknown",
+			call: func() error {
+				_, err := im.GetUserByUsername("", "bob")
+				return err
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "update unknown",
+			call: func() error { return im.UpdateUser(&store.User{Username: "bob"}) },
+			want: store.ErrNotFound,
+		},
+		{
+			name: "modify unknown",
+			call: func() error {
+				return im.ModifyUser("", "bob", func(*store.User) error { return nil })
+			},
+			want: store.ErrNotFound,
+		},
+		{
+			name: "delete unknown",
+			call: func() error { return im.DeleteUser("", "bob") },
+			want: store.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsersAreCopied(t *testing.T) {
+	im := New()
+	u := &store.User{Username: "alice", Verifier: "02"}
+	if err := im.CreateUser(u); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	u.Verifier = "03"
+
+	got, err := im.GetUserByUsername("", "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() error = %v", err)
+	}
+	got.Verifier = "04"
+
+	if got, _ := im.GetUserByUsername("", "alice"); got.Verifier != "02" {
+		t.Errorf("stored verifier = %s, want 02", got.Verifier)
+	}
+}
+
+func TestCreateRefreshTokenPurgesExpired(t *testing.T) {
+	im := New().(*InMemory)
+
+	now := time.Now()
+	tokens := []*store.RefreshToken{
+		{Hash: "expired-1", Username: "alice", ExpiresAt: now.Add(-time.Hour)},
+		{Hash: "expired-2", Username: "alice", ExpiresAt: now.Add(-time.Minute)},
+		{Hash: "live", Username: "alice", ExpiresAt: now.Add(time.Hour)},
+		{Hash: "new", Username: "alice", ExpiresAt: now.Add(2 * time.Hour)},
+	}
+	for _, rt := range tokens {
+		if err := im.CreateRefreshToken(rt); err != nil {
+			t.Fatalf("CreateRefreshToken(%s) error = %v", rt.Hash, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		hash string
+		want error
+	}{
+		{"expired-1", store.ErrNotFound},
+		{"expired-2", store.ErrNotFound},
+		{"live", nil},
+		{"new", nil},
+	} {
+		if _, err := im.UseRefreshToken(tt.hash); err != tt.want {
+			t.Errorf("UseRefreshToken(%s) error = %v, want %v", tt.hash, err, tt.want)
+		}
+	}
+	if n := im.refreshExpiry.Len(); n != 2 {
+		t.Errorf("expiry index holds %d entries, want 2", n)
+	}
+}
+
+func TestRevokeSessionPurgesExpired(t *testing.T) {
+	im := New().(*InMemory)
+
+	now := time.Now()
+	revocations := []struct {
+		sessionID string
+		until     time.Time
+	}{
+		{"expired", now.Add(-time.Minute)},
+		{"again", now.Add(-time.Hour)},
+		{"again", now.Add(time.Hour)}, // revoked again, the later entry wins
+		{"live", now.Add(time.Hour)},
+		{"last", now.Add(time.Hour)},
+	}
+	for _, r := range revocations {
+		if err := im.RevokeSession(r.sessionID, r.until); err != nil {
+			t.Fatalf("RevokeSession(%s) error = %v", r.sessionID, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		sessionID string
+		want      bool
+	}{
+		{"expired", false},
+		{"again", true},
+		{"live", true},
+		{"last", true},
+	} {
+		got, err := im.IsRevoked("", "alice", tt.sessionID, now)
+		if err != nil {
+			t.Fatalf("IsRevoked(%s) error = %v", tt.sessionID, err)
+		}
+		if got != tt.want {
+			t.Errorf("IsRevoked(%s) = %v, want %v", tt.sessionID, got, tt.want)
+		}
+	}
+	if n := im.revokedExpiry.Len(); n != 3 {
+		t.Errorf("expiry index holds %d entries, want 3", n)
+	}
+}
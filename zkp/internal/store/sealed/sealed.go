@@ -0,0 +1,438 @@
+// Package sealed encrypts the secrets of users at rest. It wraps any
+// store.Service and seals salts, verifiers and TOTP secrets with AES-256-GCM
+// before they reach it, so a leaked database is of no use for an offline
+// dictionary attack without the master key.
+//
+// Fields are sealed with a data key, which is stored next to the data
+// wrapped by a master key that never is. Rotating the master key only
+// re-wraps the data keys, Reencrypt moves every record to a new data key.
+// Records from before sealing was enabled are read as they are and sealed
+// the next time they are written.
+package sealed
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/tenant"
+)
+
+// KeyLength is the size of master and data keys
+const KeyLength = 32
+
+// prefix marks a sealed field, the data key ID and the sealed value follow
+const prefix = "sealed:v1:"
+
+var (
+	// ErrNoMasterKey is returned when no master key is given
+	ErrNoMasterKey = errors.New("no master key")
+	// ErrUnknownKey is returned for a field sealed with a data key we do not have
+	ErrUnknownKey = errors.New("sealed with an unknown data key")
+	// ErrBadSeal is returned for a field that does not open, it was changed or moved
+	ErrBadSeal = errors.New("sealed field could not be opened")
+)
+
+// Store seals users on their way into the wrapped store.Service and opens
+// them on their way out. Everything else passes straight through, so
+// methods returning users must be added here as store.Service grows.
+type Store struct {
+	store.Service
+
+	master   []byte
+	masterID string
+
+	mu      sync.RWMutex
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+// New will wrap s, sealing with the first of the master keys. The others
+// are earlier master keys, data keys wrapped by one of them are re-wrapped
+// with the first. Without any data key a new one is made.
+func New(s store.Service, masterKeys [][]byte) (*Store, error) {
+	if len(masterKeys) == 0 {
+		return nil, ErrNoMasterKey
+	}
+	masters := make(map[string][]byte, len(masterKeys))
+	for _, k := range masterKeys {
+		if len(k) != KeyLength {
+			return nil, fmt.Errorf("master keys must be %d bytes", KeyLength)
+		}
+		masters[MasterKeyID(k)] = k
+	}
+
+	ss := &Store{
+		Service:  s,
+		master:   masterKeys[0],
+		masterID: MasterKeyID(masterKeys[0]),
+		keys:     make(map[string]cipher.AEAD),
+	}
+
+	dks, err := s.ListDataKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, dk := range dks {
+		master, ok := masters[dk.MasterKeyID]
+		if !ok {
+			return nil, fmt.Errorf("data key %s is wrapped by master key %s, which was not given", dk.ID, dk.MasterKeyID)
+		}
+		key, err := open(master, dk.Wrapped, wrapAAD(dk.ID))
+		if err != nil {
+			return nil, fmt.Errorf("could not unwrap data key %s: %w", dk.ID, err)
+		}
+
+		// rotating the master key only takes wrapping the data keys again
+		if dk.MasterKeyID != ss.masterID {
+			if err := ss.wrap(dk, key); err != nil {
+				return nil, err
+			}
+		}
+		if err := ss.add(dk.ID, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if ss.primary == "" {
+		if err := ss.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ss, nil
+}
+
+// MasterKeyID names a master key without giving anything away about it
+func MasterKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("zkp master key\x00"), key...))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParseMasterKeys reads master keys, hex or base64 encoded, separated by
+// newlines or commas. Blank lines and lines starting with # are skipped.
+func ParseMasterKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := hex.DecodeString(line)
+		if err != nil {
+			key, err = base64.StdEncoding.DecodeString(line)
+		}
+		if err != nil || len(key) != KeyLength {
+			return nil, fmt.Errorf("master key %d is not %d hex or base64 encoded bytes", len(keys)+1, KeyLength)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Rotate will make a new data key that seals everything written from now on
+func (s *Store) Rotate() error {
+	key := make([]byte, KeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	dk := &store.DataKey{
+		ID:        hex.EncodeToString(id),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.wrap(dk, key); err != nil {
+		return err
+	}
+
+	return s.add(dk.ID, key)
+}
+
+// Reencrypt will seal every user with a new data key and forget the old
+// ones, it returns how many users there were. Nothing else may write to the
+// store meanwhile.
+func (s *Store) Reencrypt() (int, error) {
+	if err := s.Rotate(); err != nil {
+		return 0, err
+	}
+
+	tenants, err := s.ListTenants()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, t := range tenants {
+		users, err := s.Service.ListUsers(t.ID)
+		if err != nil {
+			return n, err
+		}
+		for _, u := range users {
+			// opening and sealing again is all ModifyUser does without changes
+			err := s.ModifyUser(t.ID, u.Username, func(*store.User) error { return nil })
+			if errors.Is(err, store.ErrNotFound) {
+				continue // deleted meanwhile
+			}
+			if err != nil {
+				return n, fmt.Errorf("could not re-encrypt %q of tenant %s: %w", u.Username, t.ID, err)
+			}
+			n++
+		}
+	}
+
+	dks, err := s.ListDataKeys()
+	if err != nil {
+		return n, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, dk := range dks {
+		if dk.ID == s.primary {
+			continue
+		}
+		if err := s.DeleteDataKey(dk.ID); err != nil {
+			return n, err
+		}
+		delete(s.keys, dk.ID)
+	}
+
+	return n, nil
+}
+
+// CreateUser will seal a copy of the user and store it
+func (s *Store) CreateUser(u *store.User) error {
+	c := u.Clone()
+	if err := s.seal(c); err != nil {
+		return err
+	}
+
+	return s.Service.CreateUser(c)
+}
+
+// GetUserByUsername will return the opened user
+func (s *Store) GetUserByUsername(tenantID, username string) (*store.User, error) {
+	u, err := s.Service.GetUserByUsername(tenantID, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.open(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// UpdateUser will seal a copy of the user and replace the stored one
+func (s *Store) UpdateUser(u *store.User) error {
+	c := u.Clone()
+	if err := s.seal(c); err != nil {
+		return err
+	}
+
+	return s.Service.UpdateUser(c)
+}
+
+// ModifyUser will hand fn the opened user and seal what it leaves behind
+func (s *Store) ModifyUser(tenantID, username string, fn func(*store.User) error) error {
+	return s.Service.ModifyUser(tenantID, username, func(u *store.User) error {
+		if err := s.open(u); err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+
+		return s.seal(u)
+	})
+}
+
+// ListUsers will return the opened users of the tenant
+func (s *Store) ListUsers(tenantID string) ([]*store.User, error) {
+	users, err := s.Service.ListUsers(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if err := s.open(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// SearchUsers will return the opened users of the tenant selected by the query
+func (s *Store) SearchUsers(tenantID string, q store.UserQuery) ([]*store.User, error) {
+	users, err := s.Service.SearchUsers(tenantID, q)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if err := s.open(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// seal will seal the secret fields of the user in place
+func (s *Store) seal(u *store.User) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name, f := range fields(u) {
+		if *f == "" || strings.HasPrefix(*f, prefix) {
+			continue
+		}
+		ciphertext, err := sealWith(s.keys[s.primary], []byte(*f), fieldAAD(u, name))
+		if err != nil {
+			return err
+		}
+		*f = prefix + s.primary + ":" + base64.RawStdEncoding.EncodeToString(ciphertext)
+	}
+
+	return nil
+}
+
+// open will open the sealed fields of the user in place, fields that were
+// never sealed are left alone
+func (s *Store) open(u *store.User) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name, f := range fields(u) {
+		if !strings.HasPrefix(*f, prefix) {
+			continue
+		}
+		id, value, ok := strings.Cut((*f)[len(prefix):], ":")
+		if !ok {
+			return ErrBadSeal
+		}
+		aead, ok := s.keys[id]
+		if !ok {
+			return ErrUnknownKey
+		}
+		ciphertext, err := base64.RawStdEncoding.DecodeString(value)
+		if err != nil {
+			return ErrBadSeal
+		}
+		plaintext, err := openWith(aead, ciphertext, fieldAAD(u, name))
+		if err != nil {
+			return ErrBadSeal
+		}
+		*f = string(plaintext)
+	}
+
+	return nil
+}
+
+// wrap will seal the data key with the current master key and store it
+func (s *Store) wrap(dk *store.DataKey, key []byte) error {
+	aead, err := newAEAD(s.master)
+	if err != nil {
+		return err
+	}
+	wrapped, err := sealWith(aead, key, wrapAAD(dk.ID))
+	if err != nil {
+		return err
+	}
+
+	dk.MasterKeyID = s.masterID
+	dk.Wrapped = wrapped
+	return s.PutDataKey(dk)
+}
+
+// add will make the data key usable and the one new fields are sealed
+// with, keys are added oldest first
+func (s *Store) add(id string, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys[id] = aead
+	s.primary = id
+	s.mu.Unlock()
+
+	return nil
+}
+
+// fields returns the secret fields of the user by name
+func fields(u *store.User) map[string]*string {
+	f := map[string]*string{
+		"salt":     &u.Salt,
+		"verifier": &u.Verifier,
+	}
+	if u.TOTP != nil {
+		f["totp_secret"] = &u.TOTP.Secret
+	}
+
+	return f
+}
+
+// fieldAAD ties a sealed field to its user and name, so it can not be
+// moved to another user or field
+func fieldAAD(u *store.User, name string) []byte {
+	return []byte("zkp user field\x00" + tenant.Key(u.Tenant, u.Username) + "\x00" + name)
+}
+
+// wrapAAD ties a wrapped data key to its ID
+func wrapAAD(id string) []byte {
+	return []byte("zkp data key\x00" + id)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealWith seals plaintext under a random nonce, which it is prefixed with
+func sealWith(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openWith opens what sealWith sealed
+func openWith(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrBadSeal
+	}
+
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], aad)
+}
+
+// open unwraps a data key with a master key
+func open(master, wrapped, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+
+	return openWith(aead, wrapped, aad)
+}
@@ -0,0 +1,282 @@
+package sealed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/imthaghost/goland/zkp/internal/store"
+	"github.com/imthaghost/goland/zkp/internal/store/inmemory"
+)
+
+// newKey returns a master key filled with b
+func newKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeyLength)
+}
+
+// alice is a user with every field that gets sealed
+func alice() *store.User {
+	return &store.User{
+		Username: "alice",
+		Salt:     "73616c74",
+		Verifier: "2a",
+		TOTP:     &store.TOTP{Secret: "JBSWY3DPEHPK3PXP"},
+	}
+}
+
+// checkUser fails unless the sealed store opens alice as she was stored
+func checkUser(t *testing.T, s *Store) {
+	t.Helper()
+
+	got, err := s.GetUserByUsername("", "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() error = %v", err)
+	}
+	want := alice()
+	if got.Salt != want.Salt || got.Verifier != want.Verifier || got.TOTP.Secret != want.TOTP.Secret {
+		t.Errorf("GetUserByUsername() = %+v, want %+v", got, want)
+	}
+}
+
+// dataKeyID returns the ID of the data key the stored salt is sealed with
+func dataKeyID(t *testing.T, backend store.Service) string {
+	t.Helper()
+
+	raw, err := backend.GetUserByUsername("", "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() error = %v", err)
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(raw.Salt, prefix), ":")
+	if !ok {
+		t.Fatalf("stored salt %q is not sealed", raw.Salt)
+	}
+
+	return id
+}
+
+func TestRoundTrip(t *testing.T) {
+	backend := inmemory.New()
+	s, err := New(backend, [][]byte{newKey(1)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := s.CreateUser(alice()); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// nothing secret reaches the wrapped store
+	raw, err := backend.GetUserByUsername("", "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() error = %v", err)
+	}
+	for name, f := range map[string]string{"salt": raw.Salt, "verifier": raw.Verifier, "totp secret": raw.TOTP.Secret} {
+		if !strings.HasPrefix(f, prefix) {
+			t.Errorf("stored %s %q is not sealed", name, f)
+		}
+	}
+
+	checkUser(t, s)
+	users, err := s.ListUsers("")
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Verifier != alice().Verifier {
+		t.Errorf("ListUsers() = %+v, want alice opened", users)
+	}
+
+	err = s.ModifyUser("", "alice", func(u *store.User) error {
+		if u.Verifier != alice().Verifier {
+			t.Errorf("ModifyUser() handed over verifier %q, want it opened", u.Verifier)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ModifyUser() error = %v", err)
+	}
+	checkUser(t, s)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    [][]byte
+		wantErr bool
+	}{
+		{name: "same key", keys: [][]byte{newKey(1)}},
+		{name: "wrong key", keys: [][]byte{newKey(2)}, wantErr: true},
+		{name: "no key", wantErr: true},
+		{name: "short key", keys: [][]byte{newKey(1)[:16]}, wantErr: true},
+		{
+			// the old master key unwraps, the new one wraps from then on
+			name: "rotated key",
+			keys: [][]byte{newKey(2), newKey(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := inmemory.New()
+			s, err := New(backend, [][]byte{newKey(1)})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := s.CreateUser(alice()); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+
+			s, err = New(backend, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			checkUser(t, s)
+
+			// once re-wrapped the first key alone is enough
+			s, err = New(backend, tt.keys[:1])
+			if err != nil {
+				t.Fatalf("New() with the first key only error = %v", err)
+			}
+			checkUser(t, s)
+		})
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	backend := inmemory.New()
+	s, err := New(backend, [][]byte{newKey(1)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := s.CreateUser(alice()); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := s.CreateTenant(&store.Tenant{ID: "acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	if err := s.CreateUser(&store.User{Tenant: "acme", Username: "bob", Salt: "00", Verifier: "02"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	old := dataKeyID(t, backend)
+
+	n, err := s.Reencrypt()
+	if err != nil {
+		t.Fatalf("Reencrypt() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Reencrypt() = %d, want 2", n)
+	}
+
+	if id := dataKeyID(t, backend); id == old {
+		t.Error("alice is still sealed with the old data key")
+	}
+	dks, err := backend.ListDataKeys()
+	if err != nil {
+		t.Fatalf("ListDataKeys() error = %v", err)
+	}
+	if len(dks) != 1 || dks[0].ID == old {
+		t.Errorf("data keys = %+v, want only the new one", dks)
+	}
+	checkUser(t, s)
+
+	// a fresh start finds everything under the one data key left
+	s, err = New(backend, [][]byte{newKey(1)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	checkUser(t, s)
+	if _, err := s.GetUserByUsername("acme", "bob"); err != nil {
+		t.Errorf("GetUserByUsername(acme, bob) error = %v", err)
+	}
+}
+
+func TestOpenRefusesMovedFields(t *testing.T) {
+	backend := inmemory.New()
+	s, err := New(backend, [][]byte{newKey(1)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, u := range []*store.User{alice(), {Username: "mallory", Salt: "00", Verifier: "03"}} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+	}
+
+	// someone with write access to the database swaps in alice's verifier
+	raw, err := backend.GetUserByUsername("", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.ModifyUser("", "mallory", func(u *store.User) error {
+		u.Verifier = raw.Verifier
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetUserByUsername("", "mallory"); !errors.Is(err, ErrBadSeal) {
+		t.Errorf("GetUserByUsername() error = %v, want %v", err, ErrBadSeal)
+	}
+}
+
+func TestPlaintextUsers(t *testing.T) {
+	backend := inmemory.New()
+	if err := backend.CreateUser(alice()); err != nil {
+		t.Fatal(err)
+	}
+
+	// users from before sealing was turned on are read as they are
+	s, err := New(backend, [][]byte{newKey(1)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	checkUser(t, s)
+
+	// and sealed the next time they are written
+	if err := s.ModifyUser("", "alice", func(*store.User) error { return nil }); err != nil {
+		t.Fatalf("ModifyUser() error = %v", err)
+	}
+	dataKeyID(t, backend)
+	checkUser(t, s)
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	key := newKey(7)
+
+	tests := []struct {
+		name    string
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{name: "hex", in: hex.EncodeToString(key), want: 1},
+		{name: "base64", in: base64.StdEncoding.EncodeToString(key), want: 1},
+		{name: "comma separated", in: hex.EncodeToString(key) + "," + base64.StdEncoding.EncodeToString(key), want: 2},
+		{name: "file", in: "# current\n" + hex.EncodeToString(key) + "\n\n# previous\n" + hex.EncodeToString(key) + "\n", want: 2},
+		{name: "empty", in: ""},
+		{name: "too short", in: hex.EncodeToString(key[:16]), wantErr: true},
+		{name: "not a key", in: "hunter2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseMasterKeys(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMasterKeys() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(keys) != tt.want {
+				t.Fatalf("ParseMasterKeys() = %d keys, want %d", len(keys), tt.want)
+			}
+			for _, k := range keys {
+				if !bytes.Equal(k, key) {
+					t.Errorf("ParseMasterKeys() = %x, want %x", k, key)
+				}
+			}
+		})
+	}
+}
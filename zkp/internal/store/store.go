@@ -1,7 +1,75 @@
 package store
 
-// Service describes how we interface with the database
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a user does not exist
+	ErrNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose username is taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrTenantNotFound is returned when a tenant does not exist
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantExists is returned when creating a tenant whose ID is taken
+	ErrTenantExists = errors.New("tenant already exists")
+)
+
+// Service describes how we interface with the database. Usernames are
+// unique per tenant, users of different tenants never see each other.
 type Service interface {
+	// CreateUser stores a new user in its tenant, it returns ErrUserExists
+	// if the username is taken there
 	CreateUser(*User) error
-	GetUserByUsername(username string) (*User, error)
+	GetUserByUsername(tenant, username string) (*User, error)
+	// UpdateUser replaces an existing user, it returns ErrNotFound if there is none
+	UpdateUser(*User) error
+	// ModifyUser applies fn to the stored user and saves the result in a single
+	// atomic step. Nothing is saved if fn returns an error, which is passed on.
+	ModifyUser(tenant, username string, fn func(*User) error) error
+	// DeleteUser removes a user, it returns ErrNotFound if there is none
+	DeleteUser(tenant, username string) error
+	// ListUsers returns every user of the tenant ordered by username
+	ListUsers(tenant string) ([]*User, error)
+	// SearchUsers returns the users of the tenant selected by the query
+	// ordered by username
+	SearchUsers(tenant string, q UserQuery) ([]*User, error)
+
+	// CreateTenant stores a new tenant, it returns ErrTenantExists if the ID is taken
+	CreateTenant(*Tenant) error
+	// GetTenant returns the tenant or ErrTenantNotFound. The default tenant
+	// always exists, with an empty policy until one is stored for it.
+	GetTenant(id string) (*Tenant, error)
+	// ListTenants returns every tenant ordered by ID, the default one included
+	ListTenants() ([]*Tenant, error)
+
+	// CreateRefreshToken stores a newly issued refresh token
+	CreateRefreshToken(*RefreshToken) error
+	// UseRefreshToken marks the token with the given hash as used and returns
+	// it as it was before, so a token that comes back with Used set is a reuse.
+	// It returns ErrNotFound if there is no such token.
+	UseRefreshToken(hash string) (*RefreshToken, error)
+	// ListRefreshTokens returns the refresh tokens of the user that have
+	// not expired, used ones included, oldest first
+	ListRefreshTokens(tenant, username string) ([]*RefreshToken, error)
+
+	// RevokeSession adds a session to the revocation list. The entry can be
+	// forgotten after until, once every token of the session has expired.
+	RevokeSession(sessionID string, until time.Time) error
+	// RevokeUserSessions revokes every session of the user issued before at
+	RevokeUserSessions(tenant, username string, at time.Time) error
+	// IsRevoked reports whether a token for the user and session issued at
+	// issuedAt has been revoked
+	IsRevoked(tenant, username, sessionID string, issuedAt time.Time) (bool, error)
+
+	// PutDataKey stores a wrapped data key, replacing one with the same ID
+	PutDataKey(*DataKey) error
+	// ListDataKeys returns every data key, oldest first
+	ListDataKeys() ([]*DataKey, error)
+	// DeleteDataKey removes a data key, removing one that does not exist is not an error
+	DeleteDataKey(id string) error
+
+	// Ping reports whether the store can currently be used
+	Ping() error
 }
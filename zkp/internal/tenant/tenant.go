@@ -0,0 +1,97 @@
+// Package tenant works out which tenant a call is for. Tenants are
+// separate namespaces of users on one deployment, each with its own policy.
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Default is the tenant of every call that does not name one, and of every
+// user from before tenants existed
+const Default = "default"
+
+// MetadataKey is the metadata key a call can name its tenant in
+const MetadataKey = "x-tenant-id"
+
+// maxLength is the longest tenant ID
+const maxLength = 63
+
+// ErrInvalid is returned for tenant IDs that are not lowercase letters,
+// digits and dashes
+var ErrInvalid = errors.New("tenant id must be 1 to 63 lowercase letters, digits or dashes, starting with a letter or digit")
+
+// request is any request that can name its tenant in a field
+type request interface {
+	GetTenantId() string
+}
+
+// FromRequest returns the tenant named in the request field
+func FromRequest(req interface{}) string {
+	if r, ok := req.(request); ok {
+		return r.GetTenantId()
+	}
+
+	return ""
+}
+
+// FromMetadata returns the tenant named in the incoming metadata
+func FromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(MetadataKey); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// FromContext returns the tenant the call is for, the request field wins
+// over metadata and it is Default when neither names one
+func FromContext(ctx context.Context, req interface{}) string {
+	if id := FromRequest(req); id != "" {
+		return id
+	}
+	if id := FromMetadata(ctx); id != "" {
+		return id
+	}
+
+	return Default
+}
+
+// Validate makes sure id is a usable tenant ID
+func Validate(id string) error {
+	if id == "" || len(id) > maxLength || id[0] == '-' {
+		return ErrInvalid
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return ErrInvalid
+		}
+	}
+
+	return nil
+}
+
+// Normalize returns Default for the empty ID of data from before tenants existed
+func Normalize(id string) string {
+	if id == "" {
+		return Default
+	}
+
+	return id
+}
+
+// Key returns a key for the username that is unique across tenants. For
+// the Default tenant it is the bare username, so data stored before tenants
+// existed keeps working. Usernames can not contain control characters, so
+// the separator can not be forged.
+func Key(tenant, username string) string {
+	if Normalize(tenant) == Default {
+		return username
+	}
+
+	return tenant + "\x00" + username
+}
@@ -0,0 +1,269 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imthaghost/goland/zkp/internal/token"
+)
+
+// header is the JWS header of every token we sign
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Keyring signs tokens as compact EdDSA JWTs. It signs with one key but
+// verifies with all of them, so tokens minted before a rotation stay valid
+// until they expire.
+type Keyring struct {
+	Issuer string
+	TTL    time.Duration
+
+	mu      sync.RWMutex
+	signing string
+	keys    map[string]ed25519.PrivateKey
+}
+
+// Issue will sign a new token for the user of the tenant and SRP session,
+// limited to scope unless it is empty and valid for ttl or TTL when it is zero
+func (k *Keyring) Issue(tenant, username, sessionID, scope string, ttl time.Duration) (string, *token.Claims, error) {
+	if ttl <= 0 {
+		ttl = k.TTL
+	}
+
+	k.mu.RLock()
+	kid := k.signing
+	key := k.keys[kid]
+	k.mu.RUnlock()
+
+	now := time.Now()
+	claims := &token.Claims{
+		Issuer:    k.Issuer,
+		Tenant:    tenant,
+		Subject:   username,
+		SessionID: sessionID,
+		Scope:     scope,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	h, err := json.Marshal(header{Alg: "EdDSA", Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", nil, err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signed := encode(h) + "." + encode(c)
+	sig := ed25519.Sign(key, []byte(signed))
+
+	return signed + "." + encode(sig), claims, nil
+}
+
+// Verify will check the signature and expiry of a token
+func (k *Keyring) Verify(t string) (*token.Claims, error) {
+	parts := strings.Split(t, ".")
+	if len(parts) != 3 {
+		return nil, token.ErrInvalid
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil || h.Alg != "EdDSA" {
+		return nil, token.ErrInvalid
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[h.Kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, token.ErrUnknownKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, token.ErrInvalid
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, token.ErrInvalid
+	}
+
+	var claims token.Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return nil, token.ErrInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, token.ErrExpired
+	}
+
+	return &claims, nil
+}
+
+// PublicKeys will return the public half of every key, sorted by key ID
+func (k *Keyring) PublicKeys() []token.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]token.PublicKey, 0, len(k.keys))
+	for kid, key := range k.keys {
+		keys = append(keys, token.PublicKey{
+			ID:  kid,
+			Key: key.Public().(ed25519.PublicKey),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys
+}
+
+// probePayload is what Check signs, it is no JWT so it can never pass Verify
+var probePayload = []byte("zkp keystore probe")
+
+// Check will sign a fixed payload with the signing key and verify it with
+// the published key of the same ID
+func (k *Keyring) Check() error {
+	k.mu.RLock()
+	kid := k.signing
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no signing key %q", kid)
+	}
+
+	sig := ed25519.Sign(key, probePayload)
+	for _, pk := range k.PublicKeys() {
+		if pk.ID == kid {
+			if !ed25519.Verify(pk.Key, probePayload, sig) {
+				return fmt.Errorf("signing key %q does not verify", kid)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("signing key %q is not published", kid)
+}
+
+// Rotate will start signing with key. The previous keys are kept so the
+// tokens they signed can still be verified.
+func (k *Keyring) Rotate(kid string, key ed25519.PrivateKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[kid] = key
+	k.signing = kid
+}
+
+// KeyID derives a stable key ID from a public key
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return encode(sum[:8])
+}
+
+// Load will read every PKCS#8 PEM encoded Ed25519 key in dir, such as ones made
+// with `openssl genpkey -algorithm ed25519 -out <kid>.pem`. The file name
+// without its extension is the key ID. Tokens are signed with signingID, or
+// with the key whose ID sorts last when signingID is empty.
+func Load(dir, signingID string) (map[string]ed25519.PrivateKey, string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no keys found in %s", dir)
+	}
+
+	keys := make(map[string]ed25519.PrivateKey)
+	var last string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, "", err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, "", fmt.Errorf("%s is not pem encoded", f)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not parse %s: %w", f, err)
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, "", fmt.Errorf("%s is not an ed25519 key", f)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		keys[kid] = key
+		if kid > last {
+			last = kid
+		}
+	}
+
+	if signingID == "" {
+		signingID = last
+	}
+	if _, ok := keys[signingID]; !ok {
+		return nil, "", fmt.Errorf("signing key %q not found in %s", signingID, dir)
+	}
+
+	return keys, signingID, nil
+}
+
+// New will create a keyring that signs with the key signingID. When keys is
+// empty a random key is generated, which is only good for development as
+// every restart invalidates all tokens.
+func New(keys map[string]ed25519.PrivateKey, signingID, issuer string, ttl time.Duration) (*Keyring, error) {
+	if ttl <= 0 {
+		ttl = token.DefaultTTL
+	}
+
+	if len(keys) == 0 {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signingID = KeyID(pub)
+		keys = map[string]ed25519.PrivateKey{signingID: priv}
+	}
+	if _, ok := keys[signingID]; !ok {
+		return nil, errors.New("signing key is not in the keyring")
+	}
+
+	return &Keyring{
+		Issuer:  issuer,
+		TTL:     ttl,
+		signing: signingID,
+		keys:    keys,
+	}, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
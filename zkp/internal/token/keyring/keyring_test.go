@@ -0,0 +1,56 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(k *Keyring)
+		wantErr bool
+	}{
+		{"signing key present", func(k *Keyring) {}, false},
+		{"signing key missing", func(k *Keyring) { k.signing = "gone" }, true},
+		// a broken private key whose seed no longer matches its public half
+		{"signing key does not verify", func(k *Keyring) {
+			k.keys["a"] = append(append(ed25519.PrivateKey(nil), other.Seed()...), key.Public().(ed25519.PublicKey)...)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := New(map[string]ed25519.PrivateKey{"a": key}, "a", "zkp", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(k)
+
+			if err := k.Check(); (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSignsNoToken(t *testing.T) {
+	k, err := New(nil, "", "zkp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what Check signs must never be mistaken for a token
+	if _, err := k.Verify(string(probePayload)); err == nil {
+		t.Fatal("Verify() accepted the probe payload")
+	}
+}
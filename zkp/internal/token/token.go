@@ -0,0 +1,80 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long a session token is valid for
+	DefaultTTL = 15 * time.Minute
+	// DefaultRefreshTTL is how long a session can be kept alive by refreshing
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+// ScopePasswordReset marks a token that is only good for changing the
+// password, it is issued instead of a session when an admin forced a reset
+const ScopePasswordReset = "password_reset"
+
+var (
+	// ErrInvalid is returned for tokens that are malformed or carry a bad signature
+	ErrInvalid = errors.New("invalid token")
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("token expired")
+	// ErrUnknownKey is returned when a token was signed with a key we do not have
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Claims is what a session token says about its holder
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Tenant    string `json:"tid,omitempty"`   // tokens from before tenants existed have none, which means the default tenant
+	Subject   string `json:"sub"`             // the username
+	SessionID string `json:"sid"`             // the SRP session the token came out of
+	Scope     string `json:"scope,omitempty"` // empty for a full session
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// PublicKey is a key other services can use to verify tokens offline
+type PublicKey struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+// Service describes how we mint and check session tokens
+type Service interface {
+	// Issue signs a new token for the user of the tenant and SRP session,
+	// limited to scope unless it is empty and valid for ttl or the
+	// service's default when it is zero
+	Issue(tenant, username, sessionID, scope string, ttl time.Duration) (string, *Claims, error)
+	// Verify checks the signature and expiry of a token and returns its claims
+	Verify(token string) (*Claims, error)
+	// PublicKeys returns every key tokens may currently be signed with
+	PublicKeys() []PublicKey
+	// Check makes sure the signing key can sign and that what it signs
+	// verifies with one of PublicKeys, without minting a token
+	Check() error
+}
+
+// NewRefreshToken returns a new opaque refresh token and the hash to store for it
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	t := base64.RawURLEncoding.EncodeToString(b)
+
+	return t, HashRefreshToken(t), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored under
+func HashRefreshToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,231 @@
+// Package totp implements RFC 6238 time based one time passwords with the
+// parameters every authenticator app supports: HMAC-SHA1, 6 digits and a
+// 30 second period. It also makes the one-time recovery codes handed out
+// alongside a secret.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Digits is the length of a code
+	Digits = 6
+	// Period is how long a code is valid for
+	Period = 30 * time.Second
+	// Skew is how many periods either side of now we accept, for clocks that are a little off
+	Skew = 1
+	// SecretSize is the size of a secret in bytes, as RFC 4226 recommends for SHA-1
+	SecretSize = 20
+	// RecoveryCodes is how many recovery codes are made at enrolment
+	RecoveryCodes = 10
+)
+
+// encoding is how secrets are shown to authenticator apps
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// phcEncoding is how salts and hashes are written in PHC strings
+var phcEncoding = base64.RawStdEncoding
+
+// NewSecret will make a random secret
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// EncodeSecret will base32 encode a secret the way authenticator apps expect
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// DecodeSecret will decode a secret made by EncodeSecret
+func DecodeSecret(s string) ([]byte, error) {
+	return encoding.DecodeString(s)
+}
+
+// URI will return the otpauth URI authenticator apps enrol from, usually shown as a QR code
+func URI(issuer, account string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeSecret(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// Step returns the time step t falls in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for a single time step
+func Code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, n%1000000)
+}
+
+// IsCode reports whether s looks like a code rather than a recovery code
+func IsCode(s string) bool {
+	if len(s) != Digits {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Verify checks code against the steps around t and returns the step it
+// matched. Steps up to and including after are skipped so a code can only
+// ever be used once, callers store the returned step as the next after.
+func Verify(secret []byte, code string, t time.Time, after int64) (int64, bool) {
+	if !IsCode(code) {
+		return 0, false
+	}
+
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		if step <= after {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// recoveryAlphabet leaves out characters that are easily confused
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// NewRecoveryCodes will make n random recovery codes such as "k3j9x-2mq7d"
+func NewRecoveryCodes(n int) ([]string, error) {
+	// bytes past the last whole multiple of the alphabet are thrown away,
+	// otherwise the first few characters would come up more often
+	limit := byte(256 - 256%len(recoveryAlphabet))
+
+	codes := make([]string, n)
+	buf := make([]byte, 16)
+	for i := range codes {
+		code := make([]byte, 0, 10)
+		for len(code) < cap(code) {
+			if _, err := rand.Read(buf); err != nil {
+				return nil, err
+			}
+			for _, b := range buf {
+				if b < limit && len(code) < cap(code) {
+					code = append(code, recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+				}
+			}
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+	}
+
+	return codes, nil
+}
+
+// recovery codes are hashed with argon2id under a salt of their own, cheap
+// enough to check every code of a user on each try
+const (
+	recoveryTime    = 1
+	recoveryMemory  = 8 << 10 // KiB
+	recoveryLanes   = 1
+	recoverySaltLen = 16
+	recoveryKeyLen  = 32
+)
+
+// HashRecoveryCode returns what is stored for a recovery code, in the PHC
+// string format. Case, spaces and dashes do not matter so codes can be
+// typed the way they were read.
+func HashRecoveryCode(code string) (string, error) {
+	salt := make([]byte, recoverySaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(normalizeRecoveryCode(code)), salt, recoveryTime, recoveryMemory, recoveryLanes, recoveryKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, recoveryMemory, recoveryTime, recoveryLanes,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+// CheckRecoveryCode reports whether code is the one hash was made from.
+// Codes handed out before they were salted are stored as plain SHA-256.
+func CheckRecoveryCode(code, hash string) bool {
+	code = normalizeRecoveryCode(code)
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		sum := sha256.Sum256([]byte(code))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(hash)) == 1
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+	var memory, iterations uint32
+	var lanes uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &lanes); err != nil {
+		return false
+	}
+	// only what we could have written ourselves, a bad hash can not make us slow
+	if memory > recoveryMemory || iterations > recoveryTime || lanes != recoveryLanes {
+		return false
+	}
+	salt, err := phcEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := phcEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got := argon2.IDKey([]byte(code), salt, iterations, memory, lanes, uint32(len(want)))
+
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// normalizeRecoveryCode drops what does not matter in a typed recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
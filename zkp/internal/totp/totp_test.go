@@ -0,0 +1,163 @@
+package totp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, the vectors are 8 digits and we keep the last 6
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(rfcSecret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("Code() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		after    int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current", code: Code(rfcSecret, step), wantStep: step, wantOK: true},
+		{name: "previous step", code: Code(rfcSecret, step-1), wantStep: step - 1, wantOK: true},
+		{name: "next step", code: Code(rfcSecret, step+1), wantStep: step + 1, wantOK: true},
+		{name: "two steps old", code: Code(rfcSecret, step-2)},
+		{
+			// a code that was accepted can not be used again
+			name:  "already used",
+			code:  Code(rfcSecret, step),
+			after: step,
+		},
+		{name: "later step than the one used", code: Code(rfcSecret, step+1), after: step, wantStep: step + 1, wantOK: true},
+		{name: "wrong", code: "000000"},
+		{name: "too short", code: "08180"},
+		{name: "not digits", code: "08180a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Verify(rfcSecret, tt.code, now, tt.after)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Verify() = %d, %v, want %d, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	if len(secret) != SecretSize {
+		t.Errorf("NewSecret() is %d bytes, want %d", len(secret), SecretSize)
+	}
+
+	got, err := DecodeSecret(EncodeSecret(secret))
+	if err != nil {
+		t.Fatalf("DecodeSecret() error = %v", err)
+	}
+	if string(got) != string(secret) {
+		t.Error("DecodeSecret(EncodeSecret()) changed the secret")
+	}
+
+	uri := URI("zkp", "alice", secret)
+	for _, want := range []string{"otpauth://totp/zkp:alice?", "secret=" + EncodeSecret(secret), "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI() = %s, want it to contain %s", uri, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(RecoveryCodes)
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodes {
+		t.Fatalf("NewRecoveryCodes() made %d codes, want %d", len(codes), RecoveryCodes)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not of the form xxxxx-xxxxx", code)
+		}
+		for _, c := range strings.Replace(code, "-", "", 1) {
+			if !strings.ContainsRune(recoveryAlphabet, c) {
+				t.Errorf("code %q has %q, which is not in the alphabet", code, c)
+			}
+		}
+		if IsCode(code) {
+			t.Errorf("IsCode(%q) = true for a recovery code", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q was made twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	hash, err := HashRecoveryCode("k3j9x-2mq7d")
+	if err != nil {
+		t.Fatalf("HashRecoveryCode() error = %v", err)
+	}
+	if again, _ := HashRecoveryCode("k3j9x-2mq7d"); again == hash {
+		t.Error("the same code hashes the same twice, want a salt of its own")
+	}
+
+	// codes from before they were salted
+	legacy := sha256.Sum256([]byte("k3j9x2mq7d"))
+
+	tests := []struct {
+		name string
+		code string
+		hash string
+		want bool
+	}{
+		{"as shown", "k3j9x-2mq7d", hash, true},
+		// codes are typed the way they were read
+		{"without the dash", "k3j9x2mq7d", hash, true},
+		{"upper case", "K3J9X-2MQ7D", hash, true},
+		{"with a space", "k3j9x 2mq7d", hash, true},
+		{"another code", "k3j9x-2mq7e", hash, false},
+		{"legacy", "K3J9X-2MQ7D", hex.EncodeToString(legacy[:]), true},
+		{"legacy another code", "k3j9x-2mq7e", hex.EncodeToString(legacy[:]), false},
+		{"malformed", "k3j9x-2mq7d", "$argon2id$v=19$m=8192", false},
+		{"too costly", "k3j9x-2mq7d", strings.Replace(hash, "m=8192", "m=4194304", 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckRecoveryCode(tt.code, tt.hash); got != tt.want {
+				t.Errorf("CheckRecoveryCode(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}